@@ -0,0 +1,45 @@
+package deephash
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HashBudget returns a fnv64a hash of src computed from at most maxLeaves
+// leaves and whether src was traversed completely
+func HashBudget(src interface{}, maxLeaves int) (uint64, bool, error) {
+	return defaultHasher.HashBudget(src, maxLeaves)
+}
+
+// HashBudget returns the hash of src like h.Hash, stopping once maxLeaves
+// leaves have been written, and whether src was traversed completely. A
+// partial hash covers the leaves written before the budget ran out, so it
+// is deterministic for a given budget but doesn't reflect the rest of src:
+// values only differing past the budget hash equal. Leaves are counted like
+// by WithMaxFields. It lets callers under a latency budget trade
+// completeness for speed. A limit set with WithMaxFields that is reached
+// first is still returned as an error.
+func (h *Hasher) HashBudget(src interface{}, maxLeaves int) (uint64, bool, error) {
+	if maxLeaves < 1 {
+		return 0, false, fmt.Errorf("maxLeaves must be positive, got %d", maxLeaves)
+	}
+	if h.cfg.maxFields > 0 && h.cfg.maxFields <= maxLeaves {
+		v, err := h.Hash(src)
+		if err != nil {
+			return 0, false, err
+		}
+		return v, true, nil
+	}
+
+	hb := &Hasher{cfg: h.cfg}
+	hb.cfg.maxFields = maxLeaves
+	fh := hb.cfg.newHash()
+	err := hb.writeCanonical(fh, src)
+	if errors.Is(err, ErrTooManyFields) {
+		return fh.Sum64(), false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return fh.Sum64(), true, nil
+}
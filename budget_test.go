@@ -0,0 +1,64 @@
+package deephash_test
+
+import (
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+func TestHashBudget(t *testing.T) {
+	type item struct {
+		ID   int
+		Name string
+	}
+	items := make([]item, 10000)
+	for i := range items {
+		items[i] = item{ID: i, Name: "item"}
+	}
+	full := deephash.Hash(items)
+
+	budget := func(src interface{}, maxLeaves int) (uint64, bool) {
+		t.Helper()
+		v, complete, err := deephash.HashBudget(src, maxLeaves)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		return v, complete
+	}
+
+	partial, complete := budget(items, 100)
+	if complete {
+		t.Errorf("want a small budget not to complete")
+	}
+	if partial == full {
+		t.Errorf("got %d, want a partial hash to differ from the full hash", partial)
+	}
+	if again, _ := budget(items, 100); again != partial {
+		t.Errorf("got %d, want partial hashes to be deterministic %d", again, partial)
+	}
+	if other, _ := budget(items, 101); other == partial {
+		t.Errorf("got %d, want a different budget to hash differently", other)
+	}
+
+	changed := append([]item(nil), items...)
+	changed[len(changed)-1].Name = "other"
+	if got, _ := budget(changed, 100); got != partial {
+		t.Errorf("got %d, want changes past the budget to be ignored %d", got, partial)
+	}
+	changed[0].Name = "other"
+	if got, _ := budget(changed, 100); got == partial {
+		t.Errorf("got %d, want changes within the budget to change the hash", got)
+	}
+
+	got, complete := budget(items, 20000)
+	if !complete {
+		t.Errorf("want a budget covering every leaf to complete")
+	}
+	if got != full {
+		t.Errorf("got %d, want a complete traversal to match Hash %d", got, full)
+	}
+
+	if _, _, err := deephash.HashBudget(items, 0); err == nil {
+		t.Errorf("want an error for a budget of no leaves")
+	}
+}
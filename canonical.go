@@ -0,0 +1,101 @@
+package deephash
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+)
+
+// Canonical returns the bytes Hash writes to its hash function for src.
+// Sub-hashes, such as those of the elements of slices hashed with
+// WithSortedSlices, appear as their 8 byte hashes rather than the bytes of
+// the values themselves. The fnv64a hash of the returned bytes equals
+// Hash(src).
+func Canonical(src interface{}) ([]byte, error) {
+	return defaultHasher.Canonical(src)
+}
+
+// Canonical returns the bytes h.Hash writes to its hash function for src
+func (h *Hasher) Canonical(src interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := h.CanonicalWriterTo(src).WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CanonicalWriterTo returns an io.WriterTo writing the bytes returned by
+// Canonical(src)
+func CanonicalWriterTo(src interface{}) io.WriterTo {
+	return defaultHasher.CanonicalWriterTo(src)
+}
+
+// CanonicalWriterTo returns an io.WriterTo writing the bytes returned by
+// h.Canonical(src), for instance to feed them to a hash function of another
+// library. The bytes are streamed to the writer as src is traversed rather
+// than collected first. src is traversed again on every call to WriteTo.
+func (h *Hasher) CanonicalWriterTo(src interface{}) io.WriterTo {
+	return canonicalWriterTo{h: h, src: src}
+}
+
+// canonicalWriterTo writes the canonical bytes of src as hashed by h
+type canonicalWriterTo struct {
+	h   *Hasher
+	src interface{}
+}
+
+func (c canonicalWriterTo) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	_, err := cw.Write(c.h.cfg.seed)
+	if err != nil {
+		return cw.n, err
+	}
+	err = c.h.writeCanonical(cw, c.src)
+	return cw.n, err
+}
+
+// HashAndCanonical returns both Hash(src) and Canonical(src)
+func HashAndCanonical(src interface{}) (uint64, []byte, error) {
+	return defaultHasher.HashAndCanonical(src)
+}
+
+// HashAndCanonical returns both h.Hash(src) and h.Canonical(src),
+// traversing src only once, for instance to log the bytes a hash was
+// computed from
+func (h *Hasher) HashAndCanonical(src interface{}) (uint64, []byte, error) {
+	var buf bytes.Buffer
+	buf.Write(h.cfg.seed)
+	// The hash is already keyed with the seed
+	fh := h.cfg.newHash()
+	err := h.writeCanonical(io.MultiWriter(fh, &buf), src)
+	if err != nil {
+		return 0, nil, err
+	}
+	return fh.Sum64(), buf.Bytes(), nil
+}
+
+// writeCanonical writes the bytes h.Canonical(src) returns after the seed
+func (h *Hasher) writeCanonical(w io.Writer, src interface{}) error {
+	err := h.cfg.writeHeader(w, h.cfg.initBytes)
+	if err != nil {
+		return err
+	}
+	err = h.cfg.writeSchema(w, reflect.TypeOf(src))
+	if err != nil {
+		return err
+	}
+	return h.writeValue(w, src)
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,102 @@
+package deephash_test
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+func TestCanonical(t *testing.T) {
+	for _, tc := range []interface{}{
+		nil,
+		"foo",
+		42,
+		testStruct{S: "bar", I: 7, Interface: map[string]int{"a": 1, "b": 2}},
+		[]float64{1.5, -2},
+	} {
+		b, err := deephash.Canonical(tc)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		h := fnv.New64a()
+		_, _ = h.Write(b)
+		if h.Sum64() != deephash.Hash(tc) {
+			t.Errorf("got %d for %#v, want the hash of the canonical bytes to match Hash %d",
+				h.Sum64(), tc, deephash.Hash(tc))
+		}
+	}
+
+	b, err := deephash.New(deephash.WithInitBytes([]byte("ns:"))).Canonical("foo")
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if string(b) != "ns:foo" {
+		t.Errorf("got %q, want %q", b, "ns:foo")
+	}
+}
+
+func TestCanonicalWriterTo(t *testing.T) {
+	src := testStruct{S: "bar", I: 7, Interface: map[string]int{"a": 1, "b": 2}}
+	h := deephash.New(deephash.WithInitBytes([]byte("ns:")), deephash.WithSeed(42))
+	expected, err := h.Canonical(src)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := h.CanonicalWriterTo(src).WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("got %x, want %x", buf.Bytes(), expected)
+	}
+	if n != int64(len(expected)) {
+		t.Errorf("got %d, want %d bytes written", n, len(expected))
+	}
+
+	_, err = deephash.CanonicalWriterTo(src).WriteTo(&failingWriter{})
+	if !errors.Is(err, errWriteFailed) {
+		t.Errorf("got %#v, want %#v", err, errWriteFailed)
+	}
+}
+
+func TestHashAndCanonical(t *testing.T) {
+	src := testStruct{S: "bar", I: 7, Interface: map[string]int{"a": 1, "b": 2}}
+	for name, h := range map[string]*deephash.Hasher{
+		"default": deephash.New(),
+		"seeded":  deephash.New(deephash.WithSeed(42), deephash.WithVersionPrefix()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			gotH, gotB, err := h.HashAndCanonical(src)
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			expectedH, err := h.Hash(src)
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			expectedB, err := h.Canonical(src)
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			if gotH != expectedH {
+				t.Errorf("got %d, want %d", gotH, expectedH)
+			}
+			if !bytes.Equal(gotB, expectedB) {
+				t.Errorf("got %x, want %x", gotB, expectedB)
+			}
+		})
+	}
+
+	gotH, _, err := deephash.HashAndCanonical(src)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if gotH != deephash.Hash(src) {
+		t.Errorf("got %d, want %d", gotH, deephash.Hash(src))
+	}
+}
@@ -0,0 +1,33 @@
+package deephash
+
+// DetectCollisions returns the pairs of indexes of values whose fnv64a
+// hashes collide
+func DetectCollisions(values []interface{}) [][2]int {
+	pairs, err := defaultHasher.DetectCollisions(values)
+	if err != nil {
+		panic(err)
+	}
+	return pairs
+}
+
+// DetectCollisions hashes each of values and returns the pairs of indexes
+// of values whose hashes collide, for instance to check that a population
+// of distinct values doesn't collide under the options of h. Each pair holds
+// the lower index first, and pairs are ordered by their higher index then
+// their lower index. Values which are equal, and so are expected to hash
+// equal, are reported like any other collision.
+func (h *Hasher) DetectCollisions(values []interface{}) ([][2]int, error) {
+	seen := make(map[uint64][]int, len(values))
+	var pairs [][2]int
+	for i, v := range values {
+		vh, err := h.Hash(v)
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range seen[vh] {
+			pairs = append(pairs, [2]int{j, i})
+		}
+		seen[vh] = append(seen[vh], i)
+	}
+	return pairs, nil
+}
@@ -0,0 +1,30 @@
+package deephash_test
+
+import (
+	"reflect"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+func TestDetectCollisions(t *testing.T) {
+	if pairs := deephash.DetectCollisions(differentTestCases); len(pairs) != 0 {
+		t.Errorf("got %#v, want no collisions", pairs)
+	}
+
+	values := append([]interface{}{}, differentTestCases[:3]...)
+	values = append(values, differentTestCases[1], "x", differentTestCases[1])
+	expected := [][2]int{{1, 3}, {1, 5}, {3, 5}}
+	if pairs := deephash.DetectCollisions(values); !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("got %#v, want %#v", pairs, expected)
+	}
+
+	h := deephash.New(deephash.WithNumericCanonical())
+	pairs, err := h.DetectCollisions([]interface{}{int64(1), "1", float64(1)})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if expected := [][2]int{{0, 2}}; !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("got %#v, want %#v", pairs, expected)
+	}
+}
@@ -0,0 +1,69 @@
+package deephash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"sort"
+)
+
+// hashConcrete returns the hash of src written without reflection and true
+// when src is of one of the common concrete types it recognizes. It writes
+// the same bytes the traversal writes for src without any options, so it
+// must only be used by a Hasher created without options.
+func hashConcrete(newHash func() hash.Hash64, src interface{}) (uint64, bool) {
+	fh := newHash()
+	switch v := src.(type) {
+	case string:
+		_, _ = fh.Write([]byte(v))
+	case int:
+		var p [8]byte
+		binary.BigEndian.PutUint64(p[:], uint64(v))
+		_, _ = fh.Write(p[:])
+	case []byte:
+		// Each byte is a leaf of its own written as a uint64
+		var p [8]byte
+		for _, b := range v {
+			p[7] = b
+			_, _ = fh.Write(p[:])
+		}
+	case map[string]string:
+		writeStringMap(newHash, fh, v)
+	default:
+		return 0, false
+	}
+	return fh.Sum64(), true
+}
+
+// writeStringMap writes the entries of m to fh like the traversal does:
+// ordered by the hash of their key then by their key, each key prefixed by
+// its length and followed by its value
+func writeStringMap(newHash func() hash.Hash64, fh hash.Hash64, m map[string]string) {
+	type entry struct {
+		kh   uint64
+		k, v string
+	}
+	entries := make([]entry, 0, len(m))
+	for k, v := range m {
+		kh := newHash()
+		_, _ = kh.Write([]byte(k))
+		entries = append(entries, entry{kh: kh.Sum64(), k: k, v: v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].kh != entries[j].kh {
+			return entries[i].kh < entries[j].kh
+		}
+		return entries[i].k < entries[j].k
+	})
+
+	var buf bytes.Buffer
+	var p [8]byte
+	for _, e := range entries {
+		buf.Reset()
+		binary.BigEndian.PutUint64(p[:], uint64(len(e.k)))
+		buf.Write(p[:])
+		buf.WriteString(e.k)
+		buf.WriteString(e.v)
+		_, _ = fh.Write(buf.Bytes())
+	}
+}
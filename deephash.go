@@ -3,257 +3,1661 @@ package deephash
 import (
 	"bytes"
 	"encoding/binary"
-	"hash/fnv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/maphash"
 	"io"
+	"math"
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 )
 
-const notEq = " is not equal"
+// AlgorithmVersion identifies the algorithm used to produce hashes. It is
+// incremented whenever a release changes the hash of any value under the
+// same options, so a stored hash is only comparable to hashes produced by
+// the same version. Hashers configured with WithVersionPrefix write the
+// version into every hash, so that stale stored hashes simply stop matching
+// after an upgrade rather than matching by accident. Stored hashes can be
+// migrated by rehashing the original values; there is no way to convert a
+// hash from one version to another.
+//
+// Values holding non-nil funcs or unsafe pointers are an exception: these are
+// hashed by address, so their hashes may change whenever the program is
+// rebuilt or restarted, whatever the version. Exclude such fields, for
+// instance with WithSkipTypes, from hashes that are stored.
+const AlgorithmVersion = 1
+
+const (
+	notEq   = " is not equal"
+	added   = " added"
+	removed = " removed"
+)
 
 // Hash returns a fnv64a hash of src, hashing recursively any exported
 // properties, including slices and maps/
+//
+// Unexported fields are hashed too, including those of unexported types
+// held in interfaces, as reflection can read them. Their methods can't be
+// called though, so values reached through unexported fields are always
+// hashed field by field: handlers such as WithStringerFallback and
+// WithDriverValuers, and Equaler when comparing, don't apply to them.
+//
+// Non-nil funcs are hashed by their code pointer, which differs between
+// builds, so the hash of a value holding one is only stable within a
+// process.
+//
+// Hash panics if src can't be hashed. It is equivalent to MustHash and is
+// retained for compatibility. A future major version will change Hash to
+// return an error like HashE.
+//
+// Deprecated: Use HashE, or MustHash to keep panicking on errors.
 func Hash(src interface{}) uint64 {
-	vSrc := reflect.ValueOf(src)
-	h := fnv.New64a()
-	err := deepHash(vSrc, "", noopFieldWriter{h}, make(map[uintptr][]reflect.Type))
+	return MustHash(src)
+}
+
+// HashE returns a fnv64a hash of src like Hash but returns an error rather
+// than panicking if src can't be hashed
+func HashE(src interface{}) (uint64, error) {
+	return defaultHasher.Hash(src)
+}
+
+// MustHash returns a fnv64a hash of src like HashE but panics if src can't
+// be hashed
+func MustHash(src interface{}) uint64 {
+	h, err := HashE(src)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// HashWithSalt returns a fnv64a hash of src like HashE but writes salt
+// before traversing src, so that, for instance, each tenant of a cache can
+// have its own hash namespace. It is equivalent to hashing src with a Hasher
+// configured using WithInitBytes(salt).
+func HashWithSalt(salt []byte, src interface{}) (uint64, error) {
+	return defaultHasher.hash(salt, src)
+}
+
+// HashWith returns the hash of src using a Hasher configured with opts. It
+// is a shorthand for New(opts...).Hash(src) for one-off hashes; reuse a
+// Hasher when hashing many values with the same options.
+func HashWith(src interface{}, opts ...Option) (uint64, error) {
+	return New(opts...).Hash(src)
+}
+
+// HashObjects returns a fnv64a hash of srcs that doesn't depend on their
+// order
+func HashObjects(srcs ...interface{}) (uint64, error) {
+	return defaultHasher.HashObjects(srcs...)
+}
+
+// HashSlice returns a fnv64a hash of items, preserving their order, for
+// instance to hash a list of positional arguments. It is equivalent to
+// HashE(items) but only accepts slices.
+func HashSlice[T any](items []T) (uint64, error) {
+	return defaultHasher.Hash(items)
+}
+
+// fastSeed seeds every FastHash. It is chosen randomly once per process.
+var fastSeed = maphash.MakeSeed()
+
+// FastHash returns a hash of src like Hash but uses hash/maphash rather
+// than fnv64a, which is faster. The result is stable for the life of the
+// process but differs between processes, so it must not be persisted or
+// shared.
+func FastHash(src interface{}) uint64 {
+	var h maphash.Hash
+	h.SetSeed(fastSeed)
+	err := defaultHasher.traverse(reflect.ValueOf(src), "", noopFieldWriter{&h})
+	if err != nil {
+		panic(err)
+	}
+	return h.Sum64()
+}
+
+// Diff returns a list of differences between lSrc and rSrc
+//
+// Diff panics if lSrc or rSrc can't be compared. It is equivalent to
+// MustDiff and is retained for compatibility. A future major version will
+// change Diff to return an error like DiffE.
+//
+// Deprecated: Use DiffE, or MustDiff to keep panicking on errors.
+func Diff(field string, lSrc, rSrc interface{}) []string {
+	return MustDiff(field, lSrc, rSrc)
+}
+
+// DiffE returns a list of differences between lSrc and rSrc like Diff but
+// returns an error rather than panicking if lSrc or rSrc can't be compared
+func DiffE(field string, lSrc, rSrc interface{}) ([]string, error) {
+	return defaultHasher.Diff(field, lSrc, rSrc)
+}
+
+// MustDiff returns a list of differences between lSrc and rSrc like DiffE
+// but panics if lSrc or rSrc can't be compared
+func MustDiff(field string, lSrc, rSrc interface{}) []string {
+	diffs, err := DiffE(field, lSrc, rSrc)
+	if err != nil {
+		panic(err)
+	}
+	return diffs
+}
+
+// DiffWithOptions returns a list of differences between lSrc and rSrc
+// using a Hasher configured with opts. It is the Diff counterpart to
+// HashWith, a shorthand for New(opts...).Diff(field, lSrc, rSrc) for one-off
+// comparisons; reuse a Hasher when comparing many values with the same
+// options.
+func DiffWithOptions(field string, lSrc, rSrc interface{}, opts ...Option) ([]string, error) {
+	return New(opts...).Diff(field, lSrc, rSrc)
+}
+
+// DiffPaths returns the paths of the differences between lSrc and rSrc
+func DiffPaths(field string, lSrc, rSrc interface{}) []string {
+	paths, err := defaultHasher.DiffPaths(field, lSrc, rSrc)
 	if err != nil {
 		panic(err)
 	}
-	return h.Sum64()
+	return paths
+}
+
+// DiffTo writes each difference between lSrc and rSrc to out as a line as
+// soon as it is found
+func DiffTo(out io.Writer, field string, lSrc, rSrc interface{}) error {
+	return defaultHasher.DiffTo(out, field, lSrc, rSrc)
+}
+
+// DiffCount returns the number of differences between lSrc and rSrc
+func DiffCount(lSrc, rSrc interface{}) int {
+	count, err := defaultHasher.DiffCount(lSrc, rSrc)
+	if err != nil {
+		panic(err)
+	}
+	return count
+}
+
+// DiffEqual returns true if there are no differences between lSrc and rSrc
+func DiffEqual(lSrc, rSrc interface{}) bool {
+	equal, err := defaultHasher.DiffEqual(lSrc, rSrc)
+	if err != nil {
+		panic(err)
+	}
+	return equal
+}
+
+// DiffStats returns the number of differences between lSrc and rSrc by the
+// kind of the differing leaf
+func DiffStats(lSrc, rSrc interface{}) map[reflect.Kind]int {
+	stats, err := defaultHasher.DiffStats(lSrc, rSrc)
+	if err != nil {
+		panic(err)
+	}
+	return stats
+}
+
+// ErrMaxDepthExceeded is returned when a value is nested deeper than the
+// depth set by WithMaxDepthError
+var ErrMaxDepthExceeded = errors.New("maximum depth exceeded")
+
+// ErrTooManyFields is returned when a traversal writes more leaves than the
+// limit set by WithMaxFields
+var ErrTooManyFields = errors.New("too many fields")
+
+// ErrPanicked is returned when traversing a value panics with
+// WithRecoverPanics
+var ErrPanicked = errors.New("panicked")
+
+// fieldWriter writes individual fields to a writer. Write writes the binary
+// representation of a leaf of kind k at f. WriteKey writes the binary
+// representation of a map key whose value is written at f.
+type fieldWriter interface {
+	Write(f string, k reflect.Kind, p []byte) error
+	WriteKey(f string, p []byte) error
+}
+
+// noopFieldWriter writes fields to a writer but ignores the field name
+type noopFieldWriter struct {
+	io.Writer
+}
+
+func (w noopFieldWriter) Write(_ string, _ reflect.Kind, p []byte) error {
+	_, err := w.Writer.Write(p)
+	return err
+}
+
+func (w noopFieldWriter) WriteKey(f string, p []byte) error {
+	return w.Write(f, reflect.Map, p)
+}
+
+// pathWriter writes each field, prefixed by its path and kind, to a buffer
+type pathWriter struct {
+	bytes.Buffer
+}
+
+func (w *pathWriter) Write(f string, k reflect.Kind, p []byte) error {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(f)))
+	_, _ = w.Buffer.Write(n[:])
+	_, _ = w.WriteString(f)
+	_ = w.WriteByte(byte(k))
+	binary.BigEndian.PutUint64(n[:], uint64(len(p)))
+	_, _ = w.Buffer.Write(n[:])
+	_, _ = w.Buffer.Write(p)
+	return nil
+}
+
+func (w *pathWriter) WriteKey(f string, p []byte) error {
+	return w.Write(f, reflect.Map, p)
+}
+
+// captureWriter captures the []byte when written to using the io.Writer
+// interface. It panics if Write is called twice.
+type captureWriter struct {
+	c []byte
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	if w.c != nil {
+		panic("captureWriter cannot be written to more than once")
+	}
+
+	w.c = p
+
+	return len(p), nil
+}
+
+// compareWriter stores binary representations of fields to be compared when
+// comparing is false. When comparing is true and subsequent calls are made,
+// differing fields are recorded to diffs. Map keys are tracked separately so
+// that a key present on only one side is reported once as added or removed
+// rather than as a difference for every field below it. Likewise, a value
+// that is nil on only one side is reported once rather than as a difference
+// for every field of the other side.
+type compareWriter struct {
+	writes    map[string]leaf
+	keys      map[string][]byte
+	added     map[string]struct{}
+	diffs     []string
+	count     int
+	countOnly bool
+	pathsOnly bool
+	stats     map[reflect.Kind]int
+	comparing bool
+	// stopEarly aborts the traversal with errDifferent once a difference
+	// has been recorded
+	stopEarly bool
+	// lNils and rNils hold the paths of nil values on each side
+	lNils map[string]struct{}
+	rNils map[string]struct{}
+	// rStructs holds the paths of the types written for structs with no
+	// hashable fields on the right side only, and rParents the ancestors of
+	// the paths written on the right side only. A struct with no hashable
+	// fields on one side isn't reported when the other side wrote fields
+	// below it, which are reported instead.
+	rStructs map[string]struct{}
+	rParents map[string]struct{}
+	// segments, when set, holds the segments of every path written, and
+	// each difference is recorded to details
+	segments map[string][]PathSegment
+	details  []Difference
+	// lBytes and rBytes hold the contents of the byte slices compared as a
+	// whole on each side, by path, when recording details
+	lBytes map[string][]byte
+	rBytes map[string][]byte
+	// lValues and rValues hold the value traversed at each path on each
+	// side when building a tree of differences
+	lValues map[string]interface{}
+	rValues map[string]interface{}
+	// equalers holds the values of the left side implementing Equaler
+	equalers map[string]Equaler
+	// types holds the dynamic types of the interfaces of the left side and
+	// retyped the paths of interfaces whose dynamic type changed, when
+	// reporting type changes
+	types   map[string]reflect.Type
+	retyped map[string]struct{}
+	// elements, when limiting the differing elements reported per
+	// container, maps the path of each element of a slice, array or map to
+	// the path of its container. shown holds the elements of each container
+	// whose differences are reported and hidden counts the differences
+	// left out of each container.
+	elements map[string]string
+	limit    int
+	shown    map[string]map[string]struct{}
+	hidden   map[string]int
+	// out, when set, receives each difference as a line as soon as it is
+	// recorded rather than it being appended to diffs. err holds the first
+	// error writing to out.
+	out io.Writer
+	err error
+}
+
+// errDifferent aborts a comparison once a difference is found when only
+// equality matters
+var errDifferent = errors.New("different")
+
+// leaf is the binary representation of a leaf of a given kind
+type leaf struct {
+	kind reflect.Kind
+	p    []byte
+}
+
+func newCompareWriter() *compareWriter {
+	return &compareWriter{
+		writes:   make(map[string]leaf),
+		keys:     make(map[string][]byte),
+		added:    make(map[string]struct{}),
+		lNils:    make(map[string]struct{}),
+		rNils:    make(map[string]struct{}),
+		rStructs: make(map[string]struct{}),
+		rParents: make(map[string]struct{}),
+		equalers: make(map[string]Equaler),
+		types:    make(map[string]reflect.Type),
+		retyped:  make(map[string]struct{}),
+	}
+}
+
+// isNilLeaf returns true when the leaf of kind k written as p is the nil
+// marker
+func isNilLeaf(k reflect.Kind, p []byte) bool {
+	return k == reflect.Invalid && bytes.HasSuffix(p, nilMarker)
+}
+
+// underLeftNil returns true if f is nested below a value that was nil on
+// the left side, in which case the nil value is reported once
+func (w *compareWriter) underLeftNil(f string) bool {
+	if len(w.lNils) == 0 {
+		return false
+	}
+	p, ok := ancestorIn(f, w.lNils)
+	if !ok {
+		return false
+	}
+	if _, ok := w.writes[p]; ok {
+		delete(w.writes, p)
+		w.record(p, notEq, reflect.Invalid)
+	}
+	return true
+}
+
+func (w *compareWriter) Write(f string, k reflect.Kind, p []byte) error {
+	if w.stopEarly && w.count > 0 {
+		return errDifferent
+	}
+	if !w.comparing {
+		w.writes[f] = leaf{kind: k, p: p}
+		if isNilLeaf(k, p) {
+			w.lNils[f] = struct{}{}
+		}
+		return nil
+	}
+
+	if underAny(f, w.added) || w.underLeftNil(f) {
+		return nil
+	}
+	if isNilLeaf(k, p) {
+		w.rNils[f] = struct{}{}
+	}
+
+	prev, ok := w.writes[f]
+	if !ok && k == reflect.Struct {
+		w.rStructs[f] = struct{}{}
+		return nil
+	}
+	if !ok {
+		addAncestors(f, w.rParents)
+	}
+	if !ok || !bytes.Equal(p, prev.p) {
+		if f == "" {
+			f = "value"
+		}
+
+		w.record(f, notEq, k)
+	}
+	delete(w.writes, f)
+
+	return nil
+}
+
+func (w *compareWriter) WriteKey(f string, p []byte) error {
+	if w.stopEarly && w.count > 0 {
+		return errDifferent
+	}
+	if !w.comparing {
+		w.keys[f] = p
+		return nil
+	}
+
+	if underAny(f, w.added) || w.underLeftNil(f) {
+		return nil
+	}
+
+	prevP, ok := w.keys[f]
+	if !ok {
+		addAncestors(f, w.rParents)
+		w.added[f] = struct{}{}
+		w.record(f, added, reflect.Map)
+		return nil
+	}
+	if !bytes.Equal(p, prevP) {
+		w.record(f, notEq, reflect.Map)
+	}
+	delete(w.keys, f)
+
+	return nil
+}
+
+// record records a difference at f of a leaf of kind k. When countOnly is
+// true, the difference is only counted.
+func (w *compareWriter) record(f, msg string, k reflect.Kind) {
+	w.count++
+	if w.stats != nil {
+		w.stats[k]++
+	}
+	if w.segments != nil {
+		d := Difference{
+			Path:     f,
+			Segments: w.segments[f],
+			Change:   changeOf(msg),
+		}
+		if b, ok := w.lBytes[f]; ok {
+			d.Left = hex.EncodeToString(b)
+		}
+		if b, ok := w.rBytes[f]; ok {
+			d.Right = hex.EncodeToString(b)
+		}
+		w.details = append(w.details, d)
+	}
+	if w.countOnly {
+		return
+	}
+	if w.elements != nil && w.hide(f) {
+		return
+	}
+	if w.pathsOnly {
+		msg = ""
+	}
+	w.emit(f + msg)
+}
+
+// emit outputs the line describing a difference
+func (w *compareWriter) emit(line string) {
+	if w.out != nil {
+		if w.err == nil {
+			_, w.err = io.WriteString(w.out, line+"\n")
+		}
+		return
+	}
+	w.diffs = append(w.diffs, line)
+}
+
+// hide returns true, counting the difference as hidden, if the difference
+// at f is within an element of a container which already has its limit of
+// differing elements reported
+func (w *compareWriter) hide(f string) bool {
+	var elems []string
+	for i := 1; i <= len(f); i++ {
+		if i < len(f) && f[i] != '.' && f[i] != '[' && f[i] != '(' {
+			continue
+		}
+		if _, ok := w.elements[f[:i]]; ok {
+			elems = append(elems, f[:i])
+		}
+	}
+
+	for _, el := range elems {
+		c := w.elements[el]
+		shown := w.shown[c]
+		if _, ok := shown[el]; ok || len(shown) < w.limit {
+			continue
+		}
+		w.hidden[c]++
+		return true
+	}
+	for _, el := range elems {
+		c := w.elements[el]
+		if w.shown[c] == nil {
+			w.shown[c] = make(map[string]struct{})
+		}
+		w.shown[c][el] = struct{}{}
+	}
+	return false
+}
+
+// writeBytes remembers the contents b of the byte slice at f, compared as
+// a whole, so that details can render them
+func (w *compareWriter) writeBytes(f string, b []byte) {
+	if w.segments == nil {
+		return
+	}
+	if w.comparing {
+		w.rBytes[f] = b
+	} else {
+		w.lBytes[f] = b
+	}
+}
+
+// typeChanged records the dynamic type t of the interface at f and returns
+// true if the interface at f on the left side held a different type, in
+// which case the change is reported and the interface shouldn't be
+// traversed further
+func (w *compareWriter) typeChanged(f string, t reflect.Type) bool {
+	if !w.comparing {
+		w.types[f] = t
+		return false
+	}
+	lt, ok := w.types[f]
+	if !ok || lt == t {
+		return false
+	}
+	w.retyped[f] = struct{}{}
+	w.record(f, ": type changed ("+typeName(lt)+" vs "+typeName(t)+")", reflect.Interface)
+	return true
+}
+
+// finish records the differences for any fields or keys only written when
+// comparing was false
+func (w *compareWriter) finish() {
+	removedKeys := make(map[string]struct{}, len(w.keys))
+	for k := range w.keys {
+		removedKeys[k] = struct{}{}
+	}
+	// Paths are sorted so that differences only found on the left side
+	// are reported in the same order every time
+	for _, k := range sortedPaths(removedKeys) {
+		if nestedUnder(k, removedKeys) || nestedUnder(k, w.rNils) || underAny(k, w.retyped) {
+			continue
+		}
+		w.record(k, removed, reflect.Map)
+	}
+
+	lParents := make(map[string]struct{})
+	for k := range w.writes {
+		addAncestors(k, lParents)
+	}
+	for k := range w.keys {
+		addAncestors(k, lParents)
+	}
+	for _, k := range sortedPaths(w.writes) {
+		if underAny(k, removedKeys) || nestedUnder(k, w.rNils) || underAny(k, w.retyped) {
+			continue
+		}
+		if _, ok := w.rParents[k]; ok && w.writes[k].kind == reflect.Struct {
+			continue
+		}
+		w.record(k, notEq, w.writes[k].kind)
+	}
+	for _, k := range sortedPaths(w.rStructs) {
+		if _, ok := lParents[k]; ok {
+			continue
+		}
+		if k == "" {
+			k = "value"
+		}
+		w.record(k, notEq, reflect.Struct)
+	}
+
+	if w.pathsOnly {
+		return
+	}
+	for _, c := range sortedPaths(w.hidden) {
+		n := w.hidden[c]
+		msg := " more differences"
+		if n == 1 {
+			msg = " more difference"
+		}
+		w.emit(c + ": " + strconv.Itoa(n) + msg)
+	}
+}
+
+// sortedPaths returns the paths keying m in order
+func sortedPaths[V any](m map[string]V) []string {
+	paths := make([]string, 0, len(m))
+	for p := range m {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// underAny returns true when f is one of paths or is nested below one of
+// paths
+func underAny(f string, paths map[string]struct{}) bool {
+	if len(paths) == 0 {
+		return false
+	}
+	if _, ok := paths[f]; ok {
+		return true
+	}
+	return nestedUnder(f, paths)
+}
+
+// nestedUnder returns true when f is nested below one of paths
+func nestedUnder(f string, paths map[string]struct{}) bool {
+	_, ok := ancestorIn(f, paths)
+	return ok
+}
+
+// addAncestors adds the paths f is nested below to paths
+func addAncestors(f string, paths map[string]struct{}) {
+	for i := 0; i < len(f); i++ {
+		if f[i] == '.' || f[i] == '[' || f[i] == '(' {
+			paths[f[:i]] = struct{}{}
+		}
+	}
+}
+
+// ancestorIn returns the first of paths that f is nested below and true, or
+// false if there is none
+func ancestorIn(f string, paths map[string]struct{}) (string, bool) {
+	if len(paths) == 0 {
+		return "", false
+	}
+	for i := 0; i < len(f); i++ {
+		if f[i] != '.' && f[i] != '[' && f[i] != '(' {
+			continue
+		}
+		if _, ok := paths[f[:i]]; ok {
+			return f[:i], true
+		}
+	}
+	return "", false
+}
+
+type mapElement struct {
+	kh   uint64
+	k, v reflect.Value
+	// kb holds the canonical bytes of k, which kh is the hash of
+	kb []byte
+	// vb holds the leaves and keys of v along with their paths, only set
+	// when breaking ties between keys with the same hash
+	vb []byte
+}
+
+// visitedPool holds empty visited maps for reuse between traversals
+var visitedPool = sync.Pool{
+	New: func() interface{} {
+		return make(map[uintptr][]visitKey)
+	},
+}
+
+// visitKey identifies a value visited at an address. Slices sharing a
+// backing array but of different lengths are distinct values, so len holds
+// the length of a slice and is zero otherwise.
+type visitKey struct {
+	typ reflect.Type
+	len int
+}
+
+// walker holds the state of a single traversal
+type walker struct {
+	cfg *config
+	h   fieldWriter
+	// visited holds the addresses being traversed further up the stack.
+	// Addresses are removed as the traversal returns from them, so its size
+	// is bounded by the depth of the value being traversed rather than by
+	// the number of distinct addresses in it, however wide the graph.
+	// Shared nodes of a directed acyclic graph are therefore traversed once
+	// per path leading to them rather than remembered.
+	visited map[uintptr][]visitKey
+	leaves  int
+	depth   int
+	// fields counts the leaves written by the whole traversal, including
+	// sub-hashes, when the number of fields is limited
+	fields *int
+	// leafType is the type of the scalar leaf about to be written when
+	// hashing with type identity
+	leafType reflect.Type
+	// cw is h when h is a compareWriter, which compares leaves as a whole
+	// rather than writing them to a hash
+	cw *compareWriter
+	// shared records the order in which pointers were first traversed when
+	// cfg.structureSensitive is set
+	shared map[pointer]uint64
+	// segments, when set, receives the segments of the path to every leaf
+	// and key written. path holds the segments of the value being traversed.
+	segments map[string][]PathSegment
+	path     []PathSegment
+	// name holds the path, as reported by Diff, of the value being
+	// traversed when named is set. Names are appended as the traversal
+	// descends and truncated as it returns, so a path is only materialized
+	// as a string when a leaf is written.
+	name  []byte
+	named bool
+	// memo, when memoizing shared values, holds the bytes written for each
+	// pointer already traversed, which mw records. cuts counts the values
+	// skipped as they were already being traversed, including by
+	// sub-walkers, as the bytes written below a skipped value depend on
+	// where it was reached from.
+	memo map[pointer]memoEntry
+	mw   *memoWriter
+	cuts *int
+	// planType and plan memoize the last struct plan looked up, so that
+	// the elements of a slice or array of structs skip the plan cache
+	planType reflect.Type
+	plan     []fieldPlan
+}
+
+// container returns the path of the slice, array or map being traversed
+// when limiting the differing elements reported per container
+func (w *walker) container() string {
+	if w.cw == nil || w.cw.elements == nil {
+		return ""
+	}
+	return w.field()
+}
+
+// recordElement remembers that the value being traversed is an element of
+// the container at path container when limiting the differing elements
+// reported per container
+func (w *walker) recordElement(container string) {
+	if w.cw == nil || w.cw.elements == nil {
+		return
+	}
+	w.cw.elements[w.field()] = container
+}
+
+// memoEntry holds the bytes written for a value reached through a pointer
+// and the number of leaves they hold
+type memoEntry struct {
+	p      []byte
+	leaves int
+}
+
+// memoWriter records the bytes written to w while recording
+type memoWriter struct {
+	w         fieldWriter
+	buf       []byte
+	recording int
+}
+
+func (m *memoWriter) Write(f string, k reflect.Kind, p []byte) error {
+	if m.recording > 0 {
+		m.buf = append(m.buf, p...)
+	}
+	return m.w.Write(f, k, p)
+}
+
+func (m *memoWriter) WriteKey(f string, p []byte) error {
+	if m.recording > 0 {
+		m.buf = append(m.buf, p...)
+	}
+	return m.w.WriteKey(f, p)
+}
+
+// memoize starts recording the bytes written for the value pointed to by
+// the pointer identified by key. The returned function stops recording and
+// remembers the bytes, unless a value was skipped as it was already being
+// traversed, and must be called once the value has been traversed.
+func (w *walker) memoize(key pointer) func() {
+	start, leaves, cuts := len(w.mw.buf), w.leaves, *w.cuts
+	w.mw.recording++
+	return func() {
+		if *w.cuts == cuts {
+			w.memo[key] = memoEntry{
+				p:      append([]byte(nil), w.mw.buf[start:]...),
+				leaves: w.leaves - leaves,
+			}
+		}
+		w.mw.recording--
+		if w.mw.recording == 0 {
+			w.mw.buf = w.mw.buf[:0]
+		}
+	}
+}
+
+// pointer identifies a pointer by its address and type
+type pointer struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// nilMarker is written in place of nil values (nil pointers, interfaces or
+// an untyped nil) so that they are distinguishable from empty values
+var nilMarker = []byte("\x00nil")
+
+// depthMarker is written in place of values nested deeper than the maximum
+// depth
+var depthMarker = []byte("\x00depth")
+
+// sharedMarker is written in place of a pointer that has already been
+// traversed, followed by the order in which it was first traversed
+var sharedMarker = []byte("\x00ref")
+
+// skipped returns true if src is of one of the skipped types, or is a nil
+// pointer to one
+func (w *walker) skipped(src reflect.Value) bool {
+	if !src.IsValid() {
+		return false
+	}
+	t := src.Type()
+	if src.Kind() == reflect.Ptr && src.IsNil() {
+		t = t.Elem()
+	}
+	_, ok := w.cfg.skipTypes[t]
+	return ok
+}
+
+// visit records that the value at addr identified by key is being
+// traversed. It returns true if the value is already being traversed further
+// up the stack. Otherwise leave must be called once the value has been
+// traversed.
+func (w *walker) visit(addr uintptr, key visitKey) (bool, func()) {
+	seen, previouslySeen := w.visited[addr]
+	for _, k := range seen {
+		if k == key {
+			if w.cuts != nil {
+				*w.cuts++
+			}
+			return true, nil
+		}
+	}
+	// Remember, remember...
+	w.visited[addr] = append(seen, key)
+	return false, func() {
+		// If we get here, we've either added a new entry in visited or
+		// a new type to the end of a slice in visited
+		if previouslySeen {
+			// If we just added a type to the end, remove it when
+			// returning from this level of recursion
+			prev := w.visited[addr]
+			w.visited[addr] = prev[0 : len(prev)-1]
+		} else {
+			// If this is the first time we've seen this memory address,
+			// pop it off when returning from this level of recursion
+			delete(w.visited, addr)
+		}
+	}
+}
+
+// release returns the visited map of w to visitedPool. w must not be used
+// afterwards.
+func (w *walker) release() {
+	// deepHash pops every address it pushes so visited should already be
+	// empty, but make sure before handing it off
+	for k := range w.visited {
+		delete(w.visited, k)
+	}
+	visitedPool.Put(w.visited)
+	w.visited = nil
+}
+
+// subHash returns the hash of src traversed on its own, sharing the
+// configuration and visited addresses of w
+func (w *walker) subHash(src reflect.Value) (uint64, error) {
+	return w.prefixedSubHash(nil, src)
+}
+
+// prefixedSubHash is like subHash but writes prefix before traversing src
+func (w *walker) prefixedSubHash(prefix []byte, src reflect.Value) (uint64, error) {
+	subH := w.cfg.newHash()
+	err := w.subTraverse(subH, prefix, src)
+	if err != nil {
+		return 0, err
+	}
+	return subH.Sum64(), nil
+}
+
+// canonicalBytes returns the bytes written when traversing src on its own,
+// after prefix
+func (w *walker) canonicalBytes(prefix []byte, src reflect.Value) ([]byte, error) {
+	var buf bytes.Buffer
+	err := w.subTraverse(&buf, prefix, src)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// subTraverse writes prefix to out then traverses src on its own into out
+func (w *walker) subTraverse(out io.Writer, prefix []byte, src reflect.Value) error {
+	_, err := out.Write(prefix)
+	if err != nil {
+		return err
+	}
+	sw := walker{cfg: w.cfg, h: noopFieldWriter{out}, visited: w.visited, depth: w.depth, fields: w.fields, cuts: w.cuts}
+	return sw.deepHash(src)
+}
+
+// pathBytes returns the leaves and keys written when traversing src on its
+// own, each along with its path relative to src and its kind
+func (w *walker) pathBytes(src reflect.Value) ([]byte, error) {
+	var pw pathWriter
+	sw := walker{cfg: w.cfg, h: &pw, visited: w.visited, depth: w.depth, fields: w.fields, cuts: w.cuts, named: true}
+	err := sw.deepHash(src)
+	if err != nil {
+		return nil, err
+	}
+	return pw.Bytes(), nil
+}
+
+// keyPrefix returns the bytes written before the map key key when hashing
+// it on its own
+func keyPrefix(key reflect.Value) []byte {
+	if key.Kind() != reflect.Interface || key.IsNil() {
+		return nil
+	}
+	return []byte(typeID(key.Elem().Type()))
+}
+
+// breakTies orders elements sharing the same key hash, which has already
+// been sorted by, so that they are written in the same order whatever the
+// map iteration order. Elements are ordered by the canonical bytes of their
+// keys, then by the leaves of their values along with their paths. Values
+// writing the same bytes may still differ in their paths, for instance
+// when an empty container moves the leaves after it, and Diff would report
+// them as different if their order depended on the map iteration order.
+func (w *walker) breakTies(elements []mapElement) error {
+	for start := 0; start < len(elements); {
+		end := start + 1
+		for end < len(elements) && elements[end].kh == elements[start].kh {
+			end++
+		}
+		if end-start > 1 {
+			run := elements[start:end]
+			for i := range run {
+				vb, err := w.pathBytes(run[i].v)
+				if err != nil {
+					return err
+				}
+				run[i].vb = vb
+			}
+			sort.Slice(run, func(i, j int) bool {
+				if c := bytes.Compare(run[i].kb, run[j].kb); c != 0 {
+					return c < 0
+				}
+				if c := bytes.Compare(run[i].vb, run[j].vb); c != 0 {
+					return c < 0
+				}
+				// Values of different dynamic types may write the same
+				// leaves, such as the values of NaN keys held in interfaces
+				return dynamicTypeID(run[i].v) < dynamicTypeID(run[j].v)
+			})
+		}
+		start = end
+	}
+	return nil
+}
+
+// dynamicTypeID returns the type identity of the value held by v if v is a
+// non-nil interface, or of v itself otherwise
+func dynamicTypeID(v reflect.Value) string {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return typeID(v.Type())
+}
+
+// keyBytes returns the canonical bytes of the map key key and their hash.
+// Keys held in interfaces also write their dynamic type so that, for
+// instance, int(1) and int8(1) keys don't collide.
+func (w *walker) keyBytes(key reflect.Value) ([]byte, uint64, error) {
+	kb, err := w.canonicalBytes(keyPrefix(key), key)
+	if err != nil {
+		return nil, 0, err
+	}
+	kh := w.cfg.newHash()
+	// Writing to a hash never fails
+	_, _ = kh.Write(kb)
+	return kb, kh.Sum64(), nil
+}
+
+// sharedRef returns a reference to the pointer src and true if src has
+// already been traversed. Otherwise src is remembered and false is returned.
+func (w *walker) sharedRef(src reflect.Value) ([]byte, bool) {
+	if w.shared == nil {
+		w.shared = make(map[pointer]uint64)
+	}
+
+	p := pointer{addr: src.Pointer(), typ: src.Type()}
+	n, ok := w.shared[p]
+	if !ok {
+		w.shared[p] = uint64(len(w.shared))
+		return nil, false
+	}
+
+	ref := make([]byte, len(sharedMarker)+8)
+	copy(ref, sharedMarker)
+	binary.BigEndian.PutUint64(ref[len(sharedMarker):], n)
+	return ref, true
+}
+
+// writeLeaf writes the binary representation p of a leaf of the given kind
+func (w *walker) writeLeaf(kind reflect.Kind, p []byte) error {
+	if w.leafType != nil {
+		p = append([]byte(typeID(w.leafType)+"\x00"), p...)
+		w.leafType = nil
+	}
+	if w.cfg.kindTags {
+		p = append([]byte{byte(kind)}, p...)
+	}
+	err := w.countLeaf()
+	if err != nil {
+		return err
+	}
+	field := w.field()
+	w.recordSegments(field)
+	return w.h.Write(field, kind, p)
+}
+
+// countLeaf counts a leaf about to be written, returning an error once more
+// leaves than allowed by WithMaxFields have been written
+func (w *walker) countLeaf() error {
+	w.leaves++
+	if w.fields == nil {
+		return nil
+	}
+	*w.fields++
+	if *w.fields > w.cfg.maxFields {
+		return fmt.Errorf("%w: more than %d", ErrTooManyFields, w.cfg.maxFields)
+	}
+	return nil
+}
+
+// chunkSize is the largest number of bytes written at once by writeBytes
+const chunkSize = 64 << 10
+
+// writeBytes writes the contents of the byte slice or array src as a single
+// leaf. When hashing, the bytes are written in chunks of at most chunkSize
+// bytes, so hashing a large array doesn't require copying it in one go.
+func (w *walker) writeBytes(src reflect.Value) error {
+	b, ok := byteSlice(src)
+	if w.cw != nil {
+		// Diffs compare a leaf as a whole
+		if !ok {
+			b = make([]byte, src.Len())
+			copyBytes(b, src, 0)
+		}
+		if w.cw.segments != nil {
+			w.cw.writeBytes(w.field(), b)
+		}
+		return w.writeLeaf(reflect.Slice, b)
+	}
+
+	field := w.field()
+
+	err := w.countLeaf()
+	if err != nil {
+		return err
+	}
+	if w.cfg.kindTags {
+		err := w.h.Write(field, reflect.Slice, []byte{byte(reflect.Slice)})
+		if err != nil {
+			return err
+		}
+	}
+
+	var buf []byte
+	for off := 0; off < src.Len(); off += chunkSize {
+		end := off + chunkSize
+		if end > src.Len() {
+			end = src.Len()
+		}
+
+		var chunk []byte
+		if ok {
+			chunk = b[off:end]
+		} else {
+			if buf == nil {
+				buf = make([]byte, chunkSize)
+			}
+			chunk = buf[:end-off]
+			copyBytes(chunk, src, off)
+		}
+
+		err := w.h.Write(field, reflect.Slice, chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// primitiveElements returns true if the elements of a slice or array of
+// type elem can be written in bulk by writePrimitives
+func (w *walker) primitiveElements(elem reflect.Type) bool {
+	if !w.cfg.primitiveFastPath || w.cw != nil || w.named {
+		return false
+	}
+	switch elem.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		return false
+	}
+	if w.cfg.containerTags || w.cfg.kindTags || w.cfg.typeIdentity || w.cfg.numericCanonical ||
+		w.cfg.floatScale != 0 || w.cfg.floatFormatter != nil {
+		return false
+	}
+	if w.cfg.maxDepth > 0 && w.depth >= w.cfg.maxDepth {
+		return false
+	}
+	if _, ok := w.cfg.skipTypes[elem]; ok {
+		return false
+	}
+	return w.handlerFor(elem) == nil
 }
 
-// FastHash has a very minor performance advantage over Hash
-// func FastHash(src interface{}) uint64 {
-// 	vSrc := reflect.ValueOf(src)
-// 	h := fnv.New64a()
-// 	err := fastDeepHash(vSrc, h, make(map[uintptr][]reflect.Type))
-// 	if err != nil {
-// 		panic(err)
-// 	}
-// 	return h.Sum64()
-// }
+// primitiveChunk is the largest number of elements encoded at once by
+// writePrimitives
+const primitiveChunk = chunkSize / 8
 
-// Diff returns a list of differences between lSrc and rSrc
-func Diff(field string, lSrc, rSrc interface{}) []string {
-	if field == "" {
-		field = "value"
-	}
+// writePrimitives writes the integer or float elements of the slice or
+// array src in chunks, each element as the same 8 bytes deepHash writes for
+// it on its own
+func (w *walker) writePrimitives(src reflect.Value) error {
+	var (
+		buf    bytes.Buffer
+		ints   []int64
+		uints  []uint64
+		floats []float64
+	)
+	for off := 0; off < src.Len(); off += primitiveChunk {
+		end := off + primitiveChunk
+		if end > src.Len() {
+			end = src.Len()
+		}
+		for i := off; i < end; i++ {
+			err := w.countLeaf()
+			if err != nil {
+				return err
+			}
+		}
 
-	cw := compareWriter{
-		writes: make(map[string][]byte),
-	}
-	vSrc := reflect.ValueOf(lSrc)
-	err := deepHash(vSrc, field, &cw, make(map[uintptr][]reflect.Type))
-	if err != nil {
-		panic(err)
-	}
+		var data interface{}
+		switch src.Type().Elem().Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			ints = ints[:0]
+			for i := off; i < end; i++ {
+				ints = append(ints, src.Index(i).Int())
+			}
+			data = ints
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			uints = uints[:0]
+			for i := off; i < end; i++ {
+				uints = append(uints, src.Index(i).Uint())
+			}
+			data = uints
+		default:
+			floats = floats[:0]
+			for i := off; i < end; i++ {
+				floats = append(floats, src.Index(i).Float())
+			}
+			data = floats
+		}
 
-	cw.comparing = true
-	vSrc = reflect.ValueOf(rSrc)
-	err = deepHash(vSrc, field, &cw, make(map[uintptr][]reflect.Type))
-	if err != nil {
-		panic(err)
+		buf.Reset()
+		err := binary.Write(&buf, binary.BigEndian, data)
+		if err != nil {
+			return err
+		}
+		err = w.h.Write("", src.Type().Elem().Kind(), buf.Bytes())
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	for k := range cw.writes {
-		cw.diffs = append(cw.diffs, k+notEq)
+// byteSlice returns the contents of the byte slice or array src without
+// copying them and true if possible
+func byteSlice(src reflect.Value) ([]byte, bool) {
+	switch {
+	case src.Kind() == reflect.Slice:
+		return src.Bytes(), true
+	case src.CanAddr():
+		return src.Slice(0, src.Len()).Bytes(), true
+	default:
+		return nil, false
 	}
-
-	return cw.diffs
 }
 
-// fieldWriter writes individual fields to a writer
-type fieldWriter interface {
-	Write(f string, p []byte) error
+// copyBytes copies len(dst) bytes from the byte slice or array src, starting
+// at off, to dst
+func copyBytes(dst []byte, src reflect.Value, off int) {
+	for i := range dst {
+		dst[i] = byte(src.Index(off + i).Uint())
+	}
 }
 
-// noopFieldWriter writes fields to a writer but ignores the field name
-type noopFieldWriter struct {
-	io.Writer
+// writeNil writes the nil marker unless nil pointers are skipped
+func (w *walker) writeNil() error {
+	if w.cfg.skipNilPointers {
+		w.leafType = nil
+		return nil
+	}
+	return w.writeLeaf(reflect.Invalid, nilMarker)
 }
 
-func (w noopFieldWriter) Write(_ string, p []byte) error {
-	_, err := w.Writer.Write(p)
-	return err
+// writeString writes the string leaf str
+func (w *walker) writeString(str string) error {
+	if w.cfg.normalizeString != nil {
+		str = w.cfg.normalizeString(str)
+	}
+	return w.writeLeaf(reflect.String, []byte(str))
 }
 
-// captureWriter captures the []byte when written to using the io.Writer
-// interface. It panics if Write is called twice.
-type captureWriter struct {
-	c []byte
+// runeString returns the string form of src and true if src is a []rune
+// or a []byte
+func runeString(src reflect.Value) (string, bool) {
+	switch src.Type().Elem().Kind() {
+	case reflect.Uint8:
+		return string(src.Bytes()), true
+	case reflect.Int32:
+		runes := make([]rune, src.Len())
+		for i := range runes {
+			runes[i] = rune(src.Index(i).Int())
+		}
+		return string(runes), true
+	default:
+		return "", false
+	}
 }
 
-func (w *captureWriter) Write(p []byte) (int, error) {
-	if w.c != nil {
-		panic("captureWriter cannot be written to more than once")
+// writeNumber writes f as the canonical form of any numeric leaf
+func (w *walker) writeNumber(f float64) error {
+	switch {
+	case f == 0:
+		// Normalizes negative zero
+		f = 0
+	case math.IsNaN(f):
+		f = math.NaN()
 	}
+	if p, ok := w.fixedPoint(f); ok {
+		return w.writeLeaf(reflect.Float64, p)
+	}
+	if w.cfg.floatFormatter != nil {
+		return w.writeLeaf(reflect.Float64, w.cfg.floatFormatter(f))
+	}
+	p := make([]byte, 8)
+	binary.BigEndian.PutUint64(p, math.Float64bits(f))
+	return w.writeLeaf(reflect.Float64, p)
+}
 
-	w.c = p
-
-	return len(p), nil
+// fixedPoint returns f scaled and rounded to an int64 as 8 big-endian bytes
+// and true when hashing with stable floats. NaNs, infinities and floats too
+// large to be represented once scaled return false.
+func (w *walker) fixedPoint(f float64) ([]byte, bool) {
+	if w.cfg.floatScale == 0 {
+		return nil, false
+	}
+	scaled := math.Round(f * w.cfg.floatScale)
+	if math.IsNaN(scaled) || scaled < math.MinInt64 || scaled >= math.MaxInt64 {
+		return nil, false
+	}
+	p := make([]byte, 8)
+	binary.BigEndian.PutUint64(p, uint64(int64(scaled)))
+	return p, true
 }
 
-// compareWriter stores binary representations of fields to be compared when
-// comparing is false. When comparing is true and subsequent calls are made,
-// differing fields are recorded to diffs.
-type compareWriter struct {
-	writes    map[string][]byte
-	diffs     []string
-	comparing bool
+// writeEmpty writes a leaf standing in for the empty slice, array or map
+// src when hashing with distinct empty values. The leaf holds the kind of
+// src, or its type when hashing with type identity.
+func (w *walker) writeEmpty(src reflect.Value) error {
+	p := []byte{byte(src.Kind())}
+	if w.cfg.typeIdentity {
+		p = append(p, typeID(src.Type())...)
+	}
+	return w.writeLeaf(src.Kind(), p)
 }
 
-func (w *compareWriter) Write(f string, p []byte) error {
-	if !w.comparing {
-		w.writes[f] = p
+// writeContainerTag writes a byte identifying the kind of container (slice,
+// array or map) before each of its elements when hashing with container tags
+func (w *walker) writeContainerTag(kind reflect.Kind) error {
+	if !w.cfg.containerTags || w.cw != nil {
 		return nil
 	}
+	return w.h.Write(w.field(), kind, []byte{byte(kind)})
+}
 
-	prevP, ok := w.writes[f]
-	if !ok || !bytes.Equal(p, prevP) {
-		if f == "" {
-			f = "value"
-		}
-
-		w.diffs = append(w.diffs, f+notEq)
+// writeLength writes the number of elements n of a slice, array or map when
+// hashing with length prefixes
+func (w *walker) writeLength(kind reflect.Kind, n int) error {
+	if !w.cfg.lengthPrefix {
+		return nil
 	}
-	delete(w.writes, f)
-
-	return nil
+	p := make([]byte, 8)
+	binary.BigEndian.PutUint64(p, uint64(n))
+	return w.writeLeaf(kind, p)
 }
 
-type mapElement struct {
-	kh   uint64
-	k, v reflect.Value
+// writeKey writes the binary representation p of a map key
+func (w *walker) writeKey(p []byte) error {
+	err := w.countLeaf()
+	if err != nil {
+		return err
+	}
+	field := w.field()
+	w.recordSegments(field)
+	return w.h.WriteKey(field, p)
 }
 
 // Traverses recursively hashing each exported value
 // During deepHash, must keep track of visited, to avoid circular traversal.
 // The algorithm is based on: https://github.com/imdario/mergo
-func deepHash(src reflect.Value, field string, h fieldWriter, visited map[uintptr][]reflect.Type) error {
+func (w *walker) deepHash(src reflect.Value) error {
+	if w.cfg.maxDepth > 0 {
+		w.depth++
+		defer func() { w.depth-- }()
+		if w.depth > w.cfg.maxDepth {
+			if w.cfg.maxDepthError {
+				return fmt.Errorf("%w at %s", ErrMaxDepthExceeded, w.field())
+			}
+			return w.writeLeaf(reflect.Invalid, depthMarker)
+		}
+	}
 	if !src.IsValid() {
-		return nil
+		return w.writeNil()
 	}
 	if src.CanAddr() {
-		addr := src.UnsafeAddr()
-		h := addr
-		seen, previouslySeen := visited[h]
-		newType := src.Type()
-		for _, typ := range seen {
-			if typ == newType {
-				return nil
-			}
+		seen, leave := w.visit(src.UnsafeAddr(), visitKey{typ: src.Type()})
+		if seen {
+			return nil
 		}
-		// Remember, remember...
-		visited[h] = append(seen, newType)
-		defer func() {
-			// If we get here, we've either added a new entry in visited or
-			// a new type to the end of a slice in visited
-			if previouslySeen {
-				// If we just added a type to the end, remove it when
-				// returning from this level of recursion
-				prev := visited[h]
-				visited[h] = prev[0 : len(prev)-1]
-			} else {
-				// If this is the first time we've seen this memory address,
-				// pop it off when returning from this level of recursion
-				delete(visited, h)
-			}
-		}()
+		defer leave()
 	}
 
 	// deal with pointers/interfaces
-	for src.Kind() == reflect.Ptr || src.Kind() == reflect.Interface {
+	for {
+		if w.cfg.skipTypes != nil && w.skipped(src) {
+			return nil
+		}
+		w.recordValue(src)
+		handled, err := w.compareEqualer(src)
+		if handled {
+			return err
+		}
+		handled, err = w.handle(src)
+		if handled {
+			return err
+		}
+		if src.Kind() != reflect.Ptr && src.Kind() != reflect.Interface {
+			break
+		}
+		if w.memo != nil && !w.named && src.Kind() == reflect.Ptr && !src.IsNil() {
+			key := pointer{addr: src.Pointer(), typ: src.Type()}
+			if m, ok := w.memo[key]; ok {
+				w.leaves += m.leaves
+				return w.h.Write("", reflect.Ptr, m.p)
+			}
+			defer w.memoize(key)()
+		}
+		if w.cfg.structureSensitive && src.Kind() == reflect.Ptr && !src.IsNil() {
+			ref, ok := w.sharedRef(src)
+			if ok {
+				return w.writeLeaf(src.Kind(), ref)
+			}
+		}
+		if w.cfg.typeChanges && w.cw != nil && src.Kind() == reflect.Interface && !src.IsNil() {
+			if w.cw.typeChanged(w.field(), src.Elem().Type()) {
+				return nil
+			}
+		}
+		if w.cfg.typeNames && w.named && src.Kind() == reflect.Interface && !src.IsNil() {
+			tName := typeName(src.Elem().Type())
+			defer w.popName(w.pushName(tName, dynamicType))
+			w.pushSegment(PathSegment{Kind: TypeSegment, Name: tName})
+			defer w.popSegment()
+		}
 		src = src.Elem()
 	}
+	if !src.IsValid() {
+		return w.writeNil()
+	}
+
+	if w.cfg.typeIdentity {
+		switch src.Kind() {
+		case reflect.Bool, reflect.String, reflect.Chan, reflect.UnsafePointer, reflect.Func,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			w.leafType = src.Type()
+		}
+	}
 
 	var cw captureWriter
 	switch src.Kind() {
 	case reflect.Struct:
-		for i, n := 0, src.NumField(); i < n; i++ {
-			var name string
-			if field != "" {
-				f := src.Type().Field(i)
-				name = appendName(field, f.Name, defaultType)
+		leaves := w.leaves
+		for _, f := range w.planFor(src.Type()) {
+			if f.skip {
+				continue
+			}
+			prev := w.pushName(f.name, defaultType)
+			w.pushSegment(PathSegment{Kind: FieldSegment, Name: f.name})
+			err := w.deepHash(src.Field(f.index))
+			w.popSegment()
+			w.popName(prev)
+			if err != nil {
+				return err
 			}
-			err := deepHash(src.Field(i), name, h, visited)
+		}
+		// A struct with no hashable fields still writes its type so that
+		// distinct types don't all hash to the same value
+		if w.leaves == leaves {
+			err := w.writeLeaf(src.Kind(), []byte(typeID(src.Type())))
 			if err != nil {
 				return err
 			}
 		}
 	case reflect.Map:
-		elements := make([]mapElement, len(src.MapKeys()))
+		err := w.writeLength(src.Kind(), src.Len())
+		if err != nil {
+			return err
+		}
+		if src.Len() == 0 && w.cfg.distinctEmpty && w.cw == nil {
+			return w.writeEmpty(src)
+		}
+		if w.cfg.mapValuesOnly {
+			return w.sortedMapValues(src)
+		}
+		elements := make([]mapElement, 0, src.Len())
 
-		for i, key := range src.MapKeys() {
-			subH := fnv.New64a()
-			kh := noopFieldWriter{subH}
-			err := deepHash(key, "", kh, visited)
+		// Values are taken from the iterator rather than looked up by key
+		// as a NaN key can't be looked up
+		iter := src.MapRange()
+		for iter.Next() {
+			key := iter.Key()
+			kb, kh, err := w.keyBytes(key)
 			if err != nil {
 				return err
 			}
-			elements[i] = mapElement{
-				kh: subH.Sum64(),
+			elements = append(elements, mapElement{
+				kh: kh,
 				k:  key,
-				v:  src.MapIndex(key),
-			}
+				v:  iter.Value(),
+				kb: kb,
+			})
 		}
 		sort.Slice(elements, func(i, j int) bool {
 			return elements[i].kh < elements[j].kh
 		})
+		err = w.breakTies(elements)
+		if err != nil {
+			return err
+		}
+		if w.cfg.mapKeyLess != nil {
+			sort.SliceStable(elements, func(i, j int) bool {
+				return w.cfg.mapKeyLess(elements[i].k, elements[j].k)
+			})
+		}
 
 		// hash each value, in order
+		var names map[string]int
+		container := w.container()
 		for _, el := range elements {
-			cw := captureWriter{}
-			err := binary.Write(&cw, binary.BigEndian, el.kh)
+			var key string
+			if w.named {
+				key = w.keyName(el.k)
+				// Distinct keys may share a name, for instance pointers
+				// to equal values, so number any repeats
+				if names == nil {
+					names = make(map[string]int, len(elements))
+				}
+				names[key]++
+				if n := names[key]; n > 1 {
+					key += "#" + strconv.Itoa(n)
+				}
+			}
+			err := w.writeContainerTag(reflect.Map)
 			if err != nil {
 				return err
 			}
-			err = h.Write(appendName(field, el.k.String(), mapKeyType), cw.c)
+			// The full key is written, rather than only its hash, so that
+			// keys whose hashes collide still hash differently. It is
+			// prefixed by its length as its value is written right after.
+			p := make([]byte, 8+len(el.kb))
+			binary.BigEndian.PutUint64(p, uint64(len(el.kb)))
+			copy(p[8:], el.kb)
+			prev := w.pushName(key, indexedType)
+			w.recordElement(container)
+			w.pushSegment(PathSegment{Kind: KeySegment, Key: key})
+			err = w.writeKey(p)
+			if err == nil {
+				err = w.deepHash(el.v)
+			}
+			w.popSegment()
+			w.popName(prev)
 			if err != nil {
 				return err
 			}
-
-			err = deepHash(el.v, appendName(field, el.k.String(), indexedType), h, visited)
+		}
+	case reflect.Slice, reflect.Array:
+		// Slices reached through interfaces aren't addressable, so also
+		// record their backing array to catch a slice containing itself.
+		// The length is recorded too as a subslice isn't its parent.
+		if src.Kind() == reflect.Slice && src.Len() > 0 {
+			seen, leave := w.visit(src.Pointer(), visitKey{typ: src.Type(), len: src.Len()})
+			if seen {
+				return nil
+			}
+			defer leave()
+		}
+		if w.cfg.byteStrings && src.Kind() == reflect.Slice && src.Type().Elem().Kind() == reflect.Uint8 {
+			if w.cfg.normalizeString != nil {
+				return w.writeString(string(src.Bytes()))
+			}
+			return w.writeLeaf(reflect.String, src.Bytes())
+		}
+		if w.cfg.runeStrings && src.Kind() == reflect.Slice {
+			if str, ok := runeString(src); ok {
+				return w.writeString(str)
+			}
+		}
+		if src.Len() == 0 && w.cfg.distinctEmpty && w.cw == nil {
+			return w.writeEmpty(src)
+		}
+		if w.cfg.byteFastPath && src.Type().Elem().Kind() == reflect.Uint8 {
+			// When comparing, the bytes are a single leaf at their path
+			// which already reflects the length
+			if w.cw == nil {
+				err := w.writeLength(src.Kind(), src.Len())
+				if err != nil {
+					return err
+				}
+			}
+			err := w.writeContainerTag(src.Kind())
 			if err != nil {
 				return err
 			}
+			return w.writeBytes(src)
 		}
-	case reflect.Slice, reflect.Array:
+		err := w.writeLength(src.Kind(), src.Len())
+		if err != nil {
+			return err
+		}
+		if w.cfg.sortedSlices && src.Type().Elem().Comparable() {
+			return w.sortedElements(src)
+		}
+		if w.primitiveElements(src.Type().Elem()) {
+			return w.writePrimitives(src)
+		}
+		container := w.container()
 		for i := 0; i < src.Len(); i++ {
-			err := deepHash(src.Index(i), appendName(field, strconv.Itoa(i), indexedType), h, visited)
+			err := w.writeContainerTag(src.Kind())
 			if err != nil {
 				return err
 			}
+			prev := w.pushIndex(i)
+			w.recordElement(container)
+			w.pushSegment(PathSegment{Kind: IndexSegment, Index: i})
+			err = w.deepHash(src.Index(i))
+			w.popSegment()
+			w.popName(prev)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Chan:
+		// The contents of a channel can't be enumerated, so only its type
+		// and whether it is nil are hashed
+		p := []byte(src.Type().ChanDir().String() + " " + typeID(src.Type().Elem()))
+		if src.IsNil() {
+			p = append(p, nilMarker...)
+		}
+		err := w.writeLeaf(src.Kind(), p)
+		if err != nil {
+			return err
 		}
 	case reflect.String:
-		err := h.Write(field, []byte(src.String()))
+		err := w.writeString(src.String())
 		if err != nil {
 			return err
 		}
 	case reflect.Bool:
 		if src.Bool() {
-			err := h.Write(field, []byte("1"))
+			err := w.writeLeaf(src.Kind(), []byte("1"))
 			if err != nil {
 				return err
 			}
 		} else {
-			err := h.Write(field, []byte("0"))
+			err := w.writeLeaf(src.Kind(), []byte("0"))
 			if err != nil {
 				return err
 			}
 		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if w.cfg.numericCanonical {
+			return w.writeNumber(float64(src.Int()))
+		}
 		err := binary.Write(&cw, binary.BigEndian, src.Int())
 		if err != nil {
 			return err
 		}
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if w.cfg.numericCanonical {
+			return w.writeNumber(float64(src.Uint()))
+		}
 		err := binary.Write(&cw, binary.BigEndian, src.Uint())
 		if err != nil {
 			return err
 		}
+	case reflect.UnsafePointer, reflect.Func:
+		// Funcs are identified by their code pointer, so like unsafe
+		// pointers they only hash consistently within a process, and
+		// closures created by the same function literal hash equal
+		if src.IsNil() {
+			return w.writeNil()
+		}
+		err := binary.Write(&cw, binary.BigEndian, uint64(src.Pointer()))
+		if err != nil {
+			return err
+		}
 	case reflect.Float32, reflect.Float64:
+		if w.cfg.numericCanonical {
+			return w.writeNumber(src.Float())
+		}
+		if p, ok := w.fixedPoint(src.Float()); ok {
+			return w.writeLeaf(src.Kind(), p)
+		}
+		if w.cfg.floatFormatter != nil {
+			return w.writeLeaf(src.Kind(), w.cfg.floatFormatter(src.Float()))
+		}
 		err := binary.Write(&cw, binary.BigEndian, src.Float())
 		if err != nil {
 			return err
@@ -264,7 +1668,7 @@ func deepHash(src reflect.Value, field string, h fieldWriter, visited map[uintpt
 		return nil
 	}
 
-	err := h.Write(field, cw.c)
+	err := w.writeLeaf(src.Kind(), cw.c)
 	if err != nil {
 		return err
 	}
@@ -272,157 +1676,275 @@ func deepHash(src reflect.Value, field string, h fieldWriter, visited map[uintpt
 	return nil
 }
 
+// fieldPlan describes how a struct field is traversed
+type fieldPlan struct {
+	index int
+	// name is the name of the field in paths, after any field name mapper
+	name string
+	// skip is set when the field is of one of the skipped types
+	skip bool
+}
+
+// planFor returns the plan of each field of the struct type t, in order.
+// The plans for each type are computed once per Hasher.
+func (w *walker) planFor(t reflect.Type) []fieldPlan {
+	if t == w.planType {
+		return w.plan
+	}
+	if w.cfg.plans != nil {
+		if plan, ok := w.cfg.plans.Load(t); ok {
+			w.planType, w.plan = t, plan.([]fieldPlan)
+			return w.plan
+		}
+	}
+
+	plan := make([]fieldPlan, t.NumField())
+	for i := range plan {
+		f := t.Field(i)
+		name := f.Name
+		if w.cfg.fieldNameMapper != nil {
+			name = w.cfg.fieldNameMapper(name)
+		}
+		_, skip := w.cfg.skipTypes[f.Type]
+		plan[i] = fieldPlan{index: i, name: name, skip: skip}
+	}
+
+	if w.cfg.plans != nil {
+		w.cfg.plans.Store(t, plan)
+	}
+	w.planType, w.plan = t, plan
+	return plan
+}
+
+// sortedElements hashes each element of the slice or array src on its own
+// and writes the resulting hashes in sorted order
+func (w *walker) sortedElements(src reflect.Value) error {
+	hashes := make([]uint64, src.Len())
+	for i := range hashes {
+		eh, err := w.subHash(src.Index(i))
+		if err != nil {
+			return err
+		}
+		hashes[i] = eh
+	}
+	return w.writeSortedHashes(hashes, src.Kind(), src.Type().Elem().Kind())
+}
+
+// sortedMapValues hashes each value of the map src on its own and writes
+// the resulting hashes in sorted order. The keys aren't written.
+func (w *walker) sortedMapValues(src reflect.Value) error {
+	hashes := make([]uint64, 0, src.Len())
+	iter := src.MapRange()
+	for iter.Next() {
+		vh, err := w.subHash(iter.Value())
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, vh)
+	}
+	return w.writeSortedHashes(hashes, src.Kind(), src.Type().Elem().Kind())
+}
+
+// writeSortedHashes writes the element hashes of a container of the given
+// kind in sorted order, each as a leaf of kind elemKind at its index in the
+// sorted order
+func (w *walker) writeSortedHashes(hashes []uint64, kind, elemKind reflect.Kind) error {
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i] < hashes[j]
+	})
+
+	for i, eh := range hashes {
+		err := w.writeContainerTag(kind)
+		if err != nil {
+			return err
+		}
+		cw := captureWriter{}
+		err = binary.Write(&cw, binary.BigEndian, eh)
+		if err != nil {
+			return err
+		}
+		prev := w.pushIndex(i)
+		w.pushSegment(PathSegment{Kind: IndexSegment, Index: i})
+		err = w.writeLeaf(elemKind, cw.c)
+		w.popSegment()
+		w.popName(prev)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// typeID returns a string identifying t, qualified by its package path
+// when t is a named type. Unnamed types are identified by their structure,
+// written like reflect.Type.String() but with named types qualified and
+// without struct tags, so that distinct anonymous struct types with the same
+// fields are identified alike.
+func typeID(t reflect.Type) string {
+	if t.Name() != "" {
+		if t.PkgPath() != "" {
+			return t.PkgPath() + "." + t.Name()
+		}
+		return t.String()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + typeID(t.Elem())
+	case reflect.Slice:
+		return "[]" + typeID(t.Elem())
+	case reflect.Array:
+		return "[" + strconv.Itoa(t.Len()) + "]" + typeID(t.Elem())
+	case reflect.Map:
+		return "map[" + typeID(t.Key()) + "]" + typeID(t.Elem())
+	case reflect.Chan:
+		elem := typeID(t.Elem())
+		if t.ChanDir() == reflect.BothDir && t.Elem().Kind() == reflect.Chan &&
+			t.Elem().Name() == "" && t.Elem().ChanDir() == reflect.RecvDir {
+			elem = "(" + elem + ")"
+		}
+		return t.ChanDir().String() + " " + elem
+	case reflect.Struct:
+		if t.NumField() == 0 {
+			return "struct {}"
+		}
+		fields := make([]string, t.NumField())
+		for i := range fields {
+			f := t.Field(i)
+			fields[i] = typeID(f.Type)
+			if !f.Anonymous {
+				fields[i] = f.Name + " " + fields[i]
+			}
+		}
+		return "struct { " + strings.Join(fields, "; ") + " }"
+	default:
+		return t.String()
+	}
+}
+
+// typeName returns the name of t as used in diff paths
+func typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+// keyName returns the name of the map key k as used in diff paths. Keys held
+// in interfaces are qualified by their dynamic type and pointers are named
+// by the value they point to.
+func (w *walker) keyName(k reflect.Value) string {
+	switch {
+	case k.Kind() == reflect.Interface:
+		if k.IsNil() {
+			return "nil"
+		}
+		e := k.Elem()
+		return e.Type().String() + "(" + w.keyName(e) + ")"
+	case k.Kind() == reflect.Ptr:
+		// Addresses change from run to run, so name pointers by the value
+		// they point to
+		if k.IsNil() {
+			return "nil"
+		}
+		return w.keyName(k.Elem())
+	case k.Kind() == reflect.String:
+		if w.cfg.normalizeString != nil {
+			return w.cfg.normalizeString(k.String())
+		}
+		return k.String()
+	case k.CanInterface():
+		return fmt.Sprint(k.Interface())
+	default:
+		// Keys of maps reached through unexported fields can't be converted
+		// to an interface{}, but fmt still prints the value they hold
+		return fmt.Sprint(k)
+	}
+}
+
 type namedType int
 
 const (
 	defaultType = namedType(iota)
-	mapKeyType
 	indexedType
+	dynamicType
 )
 
-func appendName(base, field string, nt namedType) string {
-	if base == "" {
+// indexPath returns the path of the element at index i of the slice or
+// array at field
+func (c *config) indexPath(field string, i int) string {
+	if field == "" {
+		return ""
+	}
+	return appendName(field, c.indexName(i), indexedType)
+}
+
+// indexName returns the name of index i in paths
+func (c *config) indexName(i int) string {
+	if c.indexFormat != nil {
+		return c.indexFormat(i)
+	}
+	return strconv.Itoa(i)
+}
+
+// field returns the path of the value being traversed, or "" when paths
+// aren't computed
+func (w *walker) field() string {
+	if !w.named {
 		return ""
 	}
+	return string(w.name)
+}
+
+// pushName appends the name of a child of the value being traversed to its
+// path, like appendName, and returns the length of the path beforehand to
+// be passed to popName once the child has been traversed
+func (w *walker) pushName(name string, nt namedType) int {
+	n := len(w.name)
+	if !w.named {
+		return n
+	}
+
+	prefix, suffix := nt.delimiters()
+	w.name = append(w.name, prefix...)
+	w.name = append(w.name, name...)
+	w.name = append(w.name, suffix...)
+	return n
+}
+
+// pushIndex is like pushName for the element at index i of a slice or array
+func (w *walker) pushIndex(i int) int {
+	if !w.named {
+		return len(w.name)
+	}
+	return w.pushName(w.cfg.indexName(i), indexedType)
+}
 
-	prefix := "["
-	suffix := "]"
+// popName truncates the path of the value being traversed to n
+func (w *walker) popName(n int) {
+	w.name = w.name[:n]
+}
+
+// delimiters returns the strings written before and after a name of type nt
+func (nt namedType) delimiters() (string, string) {
 	switch nt {
 	case defaultType:
-		prefix = "."
-		suffix = ""
-	case mapKeyType:
-		suffix = "-key" + suffix
+		return ".", ""
 	case indexedType:
+		return "[", "]"
+	case dynamicType:
+		return "(", ")"
 	default:
 		panic(nt)
 	}
+}
+
+func appendName(base, field string, nt namedType) string {
+	if base == "" {
+		return ""
+	}
 
+	prefix, suffix := nt.delimiters()
 	return base + prefix + field + suffix
 }
-
-// fastDeepHash has a very minor performance advantage over deepHash
-// func fastDeepHash(src reflect.Value, h io.Writer, visited map[uintptr][]reflect.Type) error {
-// 	if !src.IsValid() {
-// 		return nil
-// 	}
-// 	if src.CanAddr() {
-// 		addr := src.UnsafeAddr()
-// 		h := addr
-// 		seen, previouslySeen := visited[h]
-// 		newType := src.Type()
-// 		for _, typ := range seen {
-// 			if typ == newType {
-// 				return nil
-// 			}
-// 		}
-// 		// Remember, remember...
-// 		visited[h] = append(seen, newType)
-// 		defer func() {
-// 			// If we get here, we've either added a new entry in visited or
-// 			// a new type to the end of a slice in visited
-// 			if previouslySeen {
-// 				// If we just added a type to the end, remove it when
-// 				// returning from this level of recursion
-// 				prev := visited[h]
-// 				visited[h] = prev[0 : len(prev)-1]
-// 			} else {
-// 				// If this is the first time we've seen this memory address,
-// 				// pop it off when returning from this level of recursion
-// 				delete(visited, h)
-// 			}
-// 		}()
-// 	}
-//
-// 	// deal with pointers/interfaces
-// 	for src.Kind() == reflect.Ptr || src.Kind() == reflect.Interface {
-// 		src = src.Elem()
-// 	}
-//
-// 	var cw captureWriter
-// 	switch src.Kind() {
-// 	case reflect.Struct:
-// 		for i, n := 0, src.NumField(); i < n; i++ {
-// 			err := fastDeepHash(src.Field(i), h, visited)
-// 			if err != nil {
-// 				return err
-// 			}
-// 		}
-// 	case reflect.Map:
-// 		elements := make([]mapElement, len(src.MapKeys()))
-//
-// 		for i, key := range src.MapKeys() {
-// 			subH := fnv.New64a()
-// 			err := fastDeepHash(key, subH, visited)
-// 			if err != nil {
-// 				return err
-// 			}
-// 			elements[i] = mapElement{
-// 				kh: subH.Sum64(),
-// 				k:  key,
-// 				v:  src.MapIndex(key),
-// 			}
-// 		}
-// 		sort.Slice(elements, func(i, j int) bool {
-// 			return elements[i].kh < elements[j].kh
-// 		})
-//
-// 		// hash each value, in order
-// 		for _, el := range elements {
-// 			err := binary.Write(h, binary.BigEndian, el.kh)
-// 			if err != nil {
-// 				return err
-// 			}
-//
-// 			err = fastDeepHash(el.v, h, visited)
-// 			if err != nil {
-// 				return err
-// 			}
-// 		}
-// 	case reflect.Slice, reflect.Array:
-// 		for i := 0; i < src.Len(); i++ {
-// 			err := fastDeepHash(src.Index(i), h, visited)
-// 			if err != nil {
-// 				return err
-// 			}
-// 		}
-// 	case reflect.String:
-// 		_, err := h.Write([]byte(src.String()))
-// 		if err != nil {
-// 			return err
-// 		}
-// 	case reflect.Bool:
-// 		if src.Bool() {
-// 			_, err := h.Write([]byte("1"))
-// 			if err != nil {
-// 				return err
-// 			}
-// 		} else {
-// 			_, err := h.Write([]byte("0"))
-// 			if err != nil {
-// 				return err
-// 			}
-// 		}
-// 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-// 		err := binary.Write(&cw, binary.BigEndian, src.Int())
-// 		if err != nil {
-// 			return err
-// 		}
-// 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-// 		err := binary.Write(&cw, binary.BigEndian, src.Uint())
-// 		if err != nil {
-// 			return err
-// 		}
-// 	case reflect.Float32, reflect.Float64:
-// 		err := binary.Write(&cw, binary.BigEndian, src.Float())
-// 		if err != nil {
-// 			return err
-// 		}
-// 	}
-//
-// 	if cw.c == nil {
-// 		return nil
-// 	}
-//
-// 	return nil
-// }
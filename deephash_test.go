@@ -1,10 +1,20 @@
 package deephash_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
 	"reflect"
+	"runtime"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"unsafe"
 
 	"moqueries.org/deephash"
 )
@@ -134,6 +144,234 @@ func TestDifferentCases(t *testing.T) {
 	}
 }
 
+func TestDiffWithOptions(t *testing.T) {
+	type reading struct {
+		Sensor string
+		Value  float64
+		At     time.Time
+	}
+	now := time.Now()
+	l := reading{Sensor: "a", Value: 1.0001, At: now}
+	r := reading{Sensor: "a", Value: 1.0002, At: now.Add(time.Second)}
+
+	diffs, err := deephash.DiffWithOptions("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if !reflect.DeepEqual(diffs, deephash.Diff("xyz", l, r)) {
+		t.Errorf("got %#v, want DiffWithOptions without options to match Diff", diffs)
+	}
+
+	diffs, err = deephash.DiffWithOptions("xyz", l, r,
+		deephash.WithSkipTypes(reflect.TypeOf(time.Time{})), deephash.WithStableFloat(2))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+
+	r.Sensor = "b"
+	diffs, err = deephash.DiffWithOptions("xyz", l, r,
+		deephash.WithSkipTypes(reflect.TypeOf(time.Time{})), deephash.WithStableFloat(2))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz.Sensor is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	_, err = deephash.DiffWithOptions("xyz", chain(5, "a"), chain(5, "b"), deephash.WithMaxDepthError(2))
+	if !errors.Is(err, deephash.ErrMaxDepthExceeded) {
+		t.Errorf("got %#v, want ErrMaxDepthExceeded", err)
+	}
+}
+
+func TestHashWithSalt(t *testing.T) {
+	src := testStruct{S: "a", I: 1}
+	hash := func(salt string) uint64 {
+		t.Helper()
+		h, err := deephash.HashWithSalt([]byte(salt), src)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		return h
+	}
+
+	a := hash("tenant-a")
+	if a != hash("tenant-a") {
+		t.Errorf("want the same salt to be stable")
+	}
+	if a == hash("tenant-b") {
+		t.Errorf("want different salts to diverge")
+	}
+	if hash("") != deephash.Hash(src) {
+		t.Errorf("want an empty salt to match Hash")
+	}
+
+	h, err := deephash.New(deephash.WithInitBytes([]byte("tenant-a"))).Hash(src)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if h != a {
+		t.Errorf("got %d, want WithInitBytes to match HashWithSalt %d", h, a)
+	}
+}
+
+func TestChan(t *testing.T) {
+	type withChan struct {
+		S string
+		C chan int
+	}
+	type withoutChan struct {
+		S string
+	}
+
+	open1, open2 := make(chan int), make(chan int, 1)
+	if deephash.Hash(withChan{S: "a", C: open1}) != deephash.Hash(withChan{S: "a", C: open2}) {
+		t.Errorf("want open channels of the same type to hash equal")
+	}
+	if deephash.Hash(withChan{S: "a"}) == deephash.Hash(withChan{S: "a", C: open1}) {
+		t.Errorf("want nil and open channels to hash differently")
+	}
+	if deephash.Hash(withChan{S: "a"}) == deephash.Hash(withoutChan{S: "a"}) {
+		t.Errorf("want a struct with a channel to hash differently to one without")
+	}
+	if deephash.Hash(make(chan int)) == deephash.Hash(make(chan string)) {
+		t.Errorf("want channels of different element types to hash differently")
+	}
+	if deephash.Hash(make(chan testStruct)) == deephash.Hash(make(chan RefA)) {
+		t.Errorf("want channels of different named element types to hash differently")
+	}
+	var recv <-chan int = open1
+	if deephash.Hash(recv) == deephash.Hash(open1) {
+		t.Errorf("want channels of different directions to hash differently")
+	}
+
+	diffs := deephash.Diff("xyz", withChan{C: open1}, withChan{})
+	expected := []string{"xyz.C is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func funcA() {}
+
+func funcB() {}
+
+func TestFunc(t *testing.T) {
+	type withFunc struct {
+		S string
+		F func()
+	}
+
+	if deephash.Hash(map[string]func(){"a": funcA}) == deephash.Hash(map[string]func(){"a": funcB}) {
+		t.Errorf("want maps holding different funcs to hash differently")
+	}
+	if deephash.Hash(map[string]func(){"a": funcA}) != deephash.Hash(map[string]func(){"a": funcA}) {
+		t.Errorf("want maps holding the same func to hash equal")
+	}
+	if deephash.Hash(withFunc{S: "a"}) == deephash.Hash(withFunc{S: "a", F: funcA}) {
+		t.Errorf("want nil and non-nil funcs to hash differently")
+	}
+	if deephash.Hash([]func(){funcA, funcB}) == deephash.Hash([]func(){funcB, funcA}) {
+		t.Errorf("want slices of funcs in a different order to hash differently")
+	}
+
+	diffs := deephash.Diff("xyz", map[string]func(){"a": funcA}, map[string]func(){"a": funcB})
+	expected := []string{"xyz[a] is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestHashSlice(t *testing.T) {
+	ints, err := deephash.HashSlice([]int{1, 2, 3})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if ints != deephash.Hash([]int{1, 2, 3}) {
+		t.Errorf("got %d, want HashSlice to match Hash %d", ints, deephash.Hash([]int{1, 2, 3}))
+	}
+	reversed, err := deephash.HashSlice([]int{3, 2, 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if reversed == ints {
+		t.Errorf("want the order to be preserved")
+	}
+
+	structs := []testStruct{{S: "a"}, {S: "b", I: 1}}
+	got, err := deephash.HashSlice(structs)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if got != deephash.Hash(structs) {
+		t.Errorf("got %d, want HashSlice to match Hash %d", got, deephash.Hash(structs))
+	}
+
+	var none []string
+	got, err = deephash.HashSlice(none)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if got != deephash.Hash(none) {
+		t.Errorf("got %d, want HashSlice to match Hash %d", got, deephash.Hash(none))
+	}
+}
+
+func TestHashWith(t *testing.T) {
+	h, err := deephash.HashWith(testStruct{S: "a"})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if h != deephash.Hash(testStruct{S: "a"}) {
+		t.Errorf("got %d, want HashWith without options to match Hash", h)
+	}
+
+	opts := []deephash.Option{deephash.WithKindTags(), deephash.WithSkipNilPointers()}
+	h, err = deephash.HashWith(&node{Val: "a"}, opts...)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected, err := deephash.New(opts...).Hash(&node{Val: "a"})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if h != expected {
+		t.Errorf("got %d, want %d", h, expected)
+	}
+	if h == deephash.Hash(&node{Val: "a"}) {
+		t.Errorf("want the options to change the hash")
+	}
+
+	_, err = deephash.HashWith(chain(5, "a"), deephash.WithMaxDepthError(2))
+	if !errors.Is(err, deephash.ErrMaxDepthExceeded) {
+		t.Errorf("got %#v, want ErrMaxDepthExceeded", err)
+	}
+}
+
+func TestFastHash(t *testing.T) {
+	seen := make(map[uint64]bool)
+	for n, tc := range differentTestCases {
+		t.Run(fmt.Sprintf("[%d] %#v", n, tc), func(t *testing.T) {
+			h := deephash.FastHash(tc)
+			if h != deephash.FastHash(tc) {
+				t.Errorf("want FastHash to be stable within a process")
+			}
+			if seen[h] {
+				t.Errorf("Test case %v hashes to %v which has already been seen", tc, h)
+			}
+			seen[h] = true
+		})
+	}
+
+	if deephash.FastHash(&testStruct{S: "a"}) != deephash.FastHash(testStruct{S: "a"}) {
+		t.Errorf("want pointers and values to hash equal")
+	}
+}
+
 func TestSameCases(t *testing.T) {
 	for name, tcs := range map[string][]interface{}{
 		"simple stuff": {
@@ -220,6 +458,40 @@ type circular struct {
 	V *circular
 }
 
+func TestHashE(t *testing.T) {
+	for n, tc := range differentTestCases {
+		t.Run(fmt.Sprintf("[%d] %#v", n, tc), func(t *testing.T) {
+			h, err := deephash.HashE(tc)
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			if mh := deephash.MustHash(tc); h != mh {
+				t.Errorf("got %d != %d, want HashE and MustHash to agree", h, mh)
+			}
+			if dh := deephash.Hash(tc); h != dh {
+				t.Errorf("got %d != %d, want HashE and Hash to agree", h, dh)
+			}
+		})
+	}
+}
+
+func TestDiffE(t *testing.T) {
+	l := testStruct{S: "a", I: 1}
+	r := testStruct{S: "b", I: 1}
+
+	diffs, err := deephash.DiffE("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz.S is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+	if md := deephash.MustDiff("xyz", l, r); !reflect.DeepEqual(md, expected) {
+		t.Errorf("got %#v, want %#v", md, expected)
+	}
+}
+
 func TestCircular(t *testing.T) {
 	a := &circular{}
 	b := &circular{V: a}
@@ -237,6 +509,67 @@ func TestCircular(t *testing.T) {
 	}
 }
 
+func TestSelfReferentialSlice(t *testing.T) {
+	s := []interface{}{}
+	s = append(s, s)
+	if h := deephash.Hash(s); h == 0 {
+		t.Error("Hash of a slice holding a slice should yield some hash value")
+	}
+
+	self := make([]interface{}, 2)
+	self[0] = "a"
+	self[1] = self
+	if h := deephash.Hash(self); h == 0 {
+		t.Error("Hash of a self-containing slice should yield some hash value")
+	}
+
+	nested := []interface{}{"a", nil}
+	nested[1] = []interface{}{nested}
+	if h := deephash.Hash(nested); h == 0 {
+		t.Error("Hash of an indirectly self-containing slice should yield some hash value")
+	}
+	if diffs := deephash.Diff("", nested, nested); len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+
+	prefix := make([]interface{}, 2)
+	prefix[0] = "a"
+	prefix[1] = prefix[:1]
+	unshared := []interface{}{"a", []interface{}{"a"}}
+	if deephash.Hash(prefix) != deephash.Hash(unshared) {
+		t.Error("want a slice holding its own prefix to hash like an unshared copy")
+	}
+	if diffs := deephash.Diff("", prefix, unshared); len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+}
+
+type rawPointer struct {
+	P unsafe.Pointer
+}
+
+func TestUnsafePointer(t *testing.T) {
+	a, b := 1, 1
+	pa := rawPointer{P: unsafe.Pointer(&a)}
+	pb := rawPointer{P: unsafe.Pointer(&b)}
+
+	if deephash.Hash(pa) == deephash.Hash(pb) {
+		t.Errorf("want different unsafe.Pointers to hash differently")
+	}
+	if deephash.Hash(pa) != deephash.Hash(rawPointer{P: unsafe.Pointer(&a)}) {
+		t.Errorf("want equal unsafe.Pointers to hash equal")
+	}
+	if deephash.Hash(rawPointer{}) == deephash.Hash(pa) {
+		t.Errorf("want a nil unsafe.Pointer to hash differently")
+	}
+
+	diffs := deephash.Diff("xyz", pa, pb)
+	expected := []string{"xyz.P is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
 type RefB struct {
 	Id string
 }
@@ -267,6 +600,194 @@ func TestBooleans(t *testing.T) {
 	}
 }
 
+type emptyA struct{}
+
+type emptyB struct{}
+
+func TestEmptyContribution(t *testing.T) {
+	empty := deephash.Hash(struct{}{})
+	a := deephash.Hash(emptyA{})
+	b := deephash.Hash(emptyB{})
+	if a == 0 || b == 0 || empty == 0 {
+		t.Fatalf("got %d, %d, %d, want non-zero hashes", a, b, empty)
+	}
+	if a == b || a == empty || b == empty {
+		t.Errorf("got %d, %d, %d, want distinct hashes for distinct types", a, b, empty)
+	}
+
+	if deephash.Hash(emptyA{}) != deephash.Hash(&emptyA{}) {
+		t.Errorf("want values of the same type with no hashable fields to hash equal")
+	}
+}
+
+func TestDiffMapKeyPresence(t *testing.T) {
+	type pair struct {
+		A, B int
+	}
+	l := map[string]interface{}{
+		"both":   1,
+		"left":   pair{A: 1, B: 2},
+		"lnil":   nil,
+		"nested": map[string]int{"x": 1},
+	}
+	r := map[string]interface{}{
+		"both":   2,
+		"right":  pair{A: 3, B: 4},
+		"rnil":   (*pair)(nil),
+		"nested": map[string]int{"y": 1},
+	}
+
+	lr := deephash.Diff("xyz", l, r)
+	sorted := append([]string(nil), lr...)
+	sort.Strings(sorted)
+	expected := []string{
+		"xyz[both] is not equal",
+		"xyz[left] removed",
+		"xyz[lnil] removed",
+		"xyz[nested][x] removed",
+		"xyz[nested][y] added",
+		"xyz[right] added",
+		"xyz[rnil] added",
+	}
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("got %#v, want %#v", sorted, expected)
+	}
+
+	// Swapping the sides swaps added and removed keys
+	swap := strings.NewReplacer(" added", " removed", " removed", " added")
+	rl := deephash.Diff("xyz", r, l)
+	for i := range rl {
+		rl[i] = swap.Replace(rl[i])
+	}
+	sort.Strings(rl)
+	if !reflect.DeepEqual(rl, expected) {
+		t.Errorf("got %#v, want the swapped differences %#v", rl, expected)
+	}
+
+	for i := 0; i < 10; i++ {
+		if got := deephash.Diff("xyz", l, r); !reflect.DeepEqual(got, lr) {
+			t.Fatalf("got %#v, want differences in the same order every time %#v", got, lr)
+		}
+	}
+}
+
+func TestHashConcrete(t *testing.T) {
+	large := make(map[string]string, 1000)
+	for i := 0; i < 1000; i++ {
+		large[strconv.Itoa(i)] = strconv.Itoa(i * i)
+	}
+	for _, src := range []interface{}{
+		"", "foo",
+		0, 42, -42, math.MaxInt64,
+		[]byte(nil), []byte{}, []byte("foo"),
+		map[string]string(nil), map[string]string{"a": "1", "b": "2"}, large,
+	} {
+		// Canonical traverses src with reflection
+		c, err := deephash.Canonical(src)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		fh := fnv.New64a()
+		_, _ = fh.Write(c)
+		if got, expected := deephash.Hash(src), fh.Sum64(); got != expected {
+			t.Errorf("got %d, want %#v to hash like its traversal %d", got, src, expected)
+		}
+	}
+}
+
+// hidden is an unexported type only reachable through interfaces
+type hidden struct {
+	p *hiddenLeaf
+	m map[int]string
+}
+
+type hiddenLeaf struct {
+	n    int
+	next *hiddenLeaf
+}
+
+func TestUnexportedInInterface(t *testing.T) {
+	type holder struct {
+		V interface{}
+	}
+	value := func(n, m int) holder {
+		return holder{V: hidden{
+			p: &hiddenLeaf{n: 1, next: &hiddenLeaf{n: n}},
+			m: map[int]string{1: "a", m: "b"},
+		}}
+	}
+
+	if deephash.Hash(value(2, 2)) != deephash.Hash(value(2, 2)) {
+		t.Errorf("want equal values to hash equal")
+	}
+	if deephash.Hash(value(2, 2)) == deephash.Hash(value(3, 2)) {
+		t.Errorf("want nested unexported pointers to be hashed")
+	}
+	if deephash.Hash(value(2, 2)) == deephash.Hash(value(2, 3)) {
+		t.Errorf("want maps in unexported fields to be hashed")
+	}
+
+	diffs := deephash.Diff("xyz", value(2, 2), value(3, 3))
+	sort.Strings(diffs)
+	expected := []string{
+		"xyz.V.m[2] removed",
+		"xyz.V.m[3] added",
+		"xyz.V.p.next.n is not equal",
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestAnonymousStructs(t *testing.T) {
+	type tagged = struct {
+		X flags `json:"x"`
+	}
+	type plain = struct {
+		X flags
+	}
+	type other = struct {
+		X uint32
+	}
+	pairs := [][2]interface{}{
+		{plain{X: 1}, tagged{X: 1}},
+		{map[interface{}]int{plain{X: 1}: 1}, map[interface{}]int{tagged{X: 1}: 1}},
+		{(chan plain)(nil), (chan tagged)(nil)},
+		{[]interface{}{struct{ _ func() }{}}, []interface{}{struct {
+			_ func() `json:"-"`
+		}{}}},
+	}
+
+	for _, opts := range [][]deephash.Option{nil, {deephash.WithTypeIdentity()}} {
+		h := deephash.New(append(opts, deephash.WithSkipTypes(reflect.TypeOf(func() {})))...)
+
+		for _, p := range pairs {
+			if mustHash(t, h, p[0]) != mustHash(t, h, p[1]) {
+				t.Errorf("want %T and %T to hash equal", p[0], p[1])
+			}
+		}
+		if mustHash(t, h, plain{X: 1}) == mustHash(t, h, plain{X: 2}) {
+			t.Errorf("want different values to hash differently")
+		}
+		if mustHash(t, h, map[interface{}]int{plain{X: 1}: 1}) == mustHash(t, h, map[interface{}]int{other{X: 1}: 1}) {
+			t.Errorf("want map keys of structurally different types to hash differently")
+		}
+	}
+
+	h := deephash.New(deephash.WithTypeIdentity())
+	p, err := h.Hash(plain{X: 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	o, err := h.Hash(other{X: 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if p == o {
+		t.Errorf("got %d, want fields of different types to hash differently with type identity", p)
+	}
+}
+
 func TestDiff(t *testing.T) {
 	for name, tc := range map[string]struct {
 		lSrc, rSrc interface{}
@@ -278,6 +799,7 @@ func TestDiff(t *testing.T) {
 			rSrc: testStruct{I: 31, S: "2", Interface: 42},
 			expected: []string{
 				"xyz.Interface is not equal",
+				"xyz.Interface.Interface is not equal",
 				"xyz.Interface.F32 is not equal",
 				"xyz.Interface.F64 is not equal",
 				"xyz.Interface.I is not equal",
@@ -293,16 +815,6 @@ func TestDiff(t *testing.T) {
 				"xyz.S is not equal",
 			},
 		},
-		"map keys": {
-			lSrc: map[string]int{"key1": 42},
-			rSrc: map[string]int{"key2": 42},
-			expected: []string{
-				"xyz[key1] is not equal",
-				"xyz[key1-key] is not equal",
-				"xyz[key2] is not equal",
-				"xyz[key2-key] is not equal",
-			},
-		},
 		"map values": {
 			lSrc:     map[string]int{"key1": 42},
 			rSrc:     map[string]int{"key1": 43},
@@ -337,6 +849,665 @@ func TestDiff(t *testing.T) {
 	}
 }
 
+func TestDiffNil(t *testing.T) {
+	for name, v := range map[string]interface{}{
+		"struct":       testStruct{},
+		"pointer":      &testStruct{S: "a", I: 1},
+		"empty string": "",
+		"zero int":     0,
+	} {
+		t.Run(name, func(t *testing.T) {
+			expected := []string{"xyz is not equal"}
+			if diffs := deephash.Diff("xyz", nil, v); !reflect.DeepEqual(diffs, expected) {
+				t.Errorf("got %#v, want %#v between nil and %#v", diffs, expected, v)
+			}
+			if diffs := deephash.Diff("xyz", v, nil); !reflect.DeepEqual(diffs, expected) {
+				t.Errorf("got %#v, want %#v between %#v and nil", diffs, expected, v)
+			}
+			if diffs := deephash.Diff("xyz", nil, nil); len(diffs) != 0 {
+				t.Errorf("got %#v, want no differences between nils", diffs)
+			}
+			if deephash.Hash(nil) == deephash.Hash(v) {
+				t.Errorf("want nil and %#v to hash differently", v)
+			}
+		})
+	}
+}
+
+func TestDiffMapKeys(t *testing.T) {
+	for name, tc := range map[string]struct {
+		lSrc, rSrc interface{}
+		expected   []string
+	}{
+		"simple values": {
+			lSrc:     map[string]int{"key1": 42},
+			rSrc:     map[string]int{"key2": 42},
+			expected: []string{"xyz[key1] removed", "xyz[key2] added"},
+		},
+		"struct values": {
+			lSrc: map[string]testStruct{"a": {S: "1"}, "b": {S: "2"}},
+			rSrc: map[string]testStruct{"b": {S: "3"}, "c": {I: 4}},
+			expected: []string{
+				"xyz[a] removed",
+				"xyz[b].S is not equal",
+				"xyz[c] added",
+			},
+		},
+		"nested maps": {
+			lSrc: map[string]map[string]int{"a": {"x": 1}},
+			rSrc: map[string]map[string]int{"a": {"y": 1}, "b": {"z": 2}},
+			expected: []string{
+				"xyz[a][x] removed",
+				"xyz[a][y] added",
+				"xyz[b] added",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sort.Strings(tc.expected)
+
+			diffs := deephash.Diff("xyz", tc.lSrc, tc.rSrc)
+			sort.Strings(diffs)
+			if !reflect.DeepEqual(diffs, tc.expected) {
+				t.Errorf("got %#v, want %#v", diffs, tc.expected)
+			}
+
+			var reversed []string
+			for _, e := range tc.expected {
+				switch {
+				case strings.HasSuffix(e, " added"):
+					e = strings.TrimSuffix(e, " added") + " removed"
+				case strings.HasSuffix(e, " removed"):
+					e = strings.TrimSuffix(e, " removed") + " added"
+				}
+				reversed = append(reversed, e)
+			}
+			sort.Strings(reversed)
+
+			diffs = deephash.Diff("xyz", tc.rSrc, tc.lSrc)
+			sort.Strings(diffs)
+			if !reflect.DeepEqual(diffs, reversed) {
+				t.Errorf("got %#v, want %#v", diffs, reversed)
+			}
+		})
+	}
+}
+
+func TestDiffCount(t *testing.T) {
+	pairs := [][2]interface{}{
+		{"1", "2"},
+		{testStruct{I: 31, S: "1"}, testStruct{I: 32, S: "2", U8: 3}},
+		{map[string]int{"key1": 42}, map[string]int{"key2": 42, "key3": 43}},
+		{[]int{1, 2, 3, 4}, []int{1, 5, 3}},
+		{&testStruct{F32: 43.0}, testStruct{F32: 43.0}},
+	}
+	for n, p := range pairs {
+		t.Run(fmt.Sprintf("[%d]", n), func(t *testing.T) {
+			count := deephash.DiffCount(p[0], p[1])
+			diffs := deephash.Diff("", p[0], p[1])
+			if count != len(diffs) {
+				t.Errorf("got %d, want %d (%#v)", count, len(diffs), diffs)
+			}
+		})
+	}
+}
+
+func TestDiffEmptyCollectionField(t *testing.T) {
+	type item struct {
+		N int
+	}
+	type wrapper struct {
+		Items []item
+	}
+
+	diffs := deephash.Diff("", wrapper{}, wrapper{Items: []item{{N: 1}}})
+	expected := []string{"value.Items[0].N is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+	if count := deephash.DiffCount(wrapper{}, wrapper{Items: []item{{N: 1}}}); count != 1 {
+		t.Errorf("got %d, want 1", count)
+	}
+	if diffs := deephash.Diff("", wrapper{}, wrapper{Items: []item{}}); len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+	diffs = deephash.Diff("", wrapper{Items: []item{{N: 1}}}, wrapper{})
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestDiffEmptyStructTypes(t *testing.T) {
+	type a struct{}
+	type b struct{}
+	type wrapper struct {
+		I interface{}
+	}
+
+	for _, pair := range []struct {
+		l, r     interface{}
+		expected []string
+	}{
+		{l: a{}, r: b{}, expected: []string{"value is not equal"}},
+		{l: wrapper{I: a{}}, r: wrapper{I: b{}}, expected: []string{"value.I is not equal"}},
+	} {
+		if deephash.Hash(pair.l) == deephash.Hash(pair.r) {
+			t.Fatalf("want %#v and %#v to hash differently", pair.l, pair.r)
+		}
+		diffs := deephash.Diff("", pair.l, pair.r)
+		if !reflect.DeepEqual(diffs, pair.expected) {
+			t.Errorf("got %#v, want %#v", diffs, pair.expected)
+		}
+		if deephash.DiffEqual(pair.l, pair.r) {
+			t.Errorf("want %#v and %#v not to be equal", pair.l, pair.r)
+		}
+		stats := deephash.DiffStats(pair.l, pair.r)
+		if expected := map[reflect.Kind]int{reflect.Struct: 1}; !reflect.DeepEqual(stats, expected) {
+			t.Errorf("got %#v, want %#v", stats, expected)
+		}
+		if diffs := deephash.Diff("", pair.l, pair.l); len(diffs) != 0 {
+			t.Errorf("got %#v, want no differences", diffs)
+		}
+	}
+}
+
+func TestDiffEqual(t *testing.T) {
+	pairs := [][2]interface{}{
+		{"1", "1"},
+		{"1", "2"},
+		{testStruct{I: 31, S: "1"}, testStruct{I: 32, S: "2", U8: 3}},
+		{map[string]int{"key1": 42}, map[string]int{"key1": 42}},
+		{map[string]int{"key1": 42}, map[string]int{"key2": 42, "key3": 43}},
+		{map[string]int{"key1": 42, "key2": 43}, map[string]int{"key1": 42}},
+		{[]int{1, 2, 3, 4}, []int{1, 2, 3}},
+		{[]int{1, 2, 3}, []int{1, 5, 3}},
+		{&testStruct{F32: 43.0}, testStruct{F32: 43.0}},
+		{&testStruct{}, (*testStruct)(nil)},
+	}
+	for n, p := range pairs {
+		t.Run(fmt.Sprintf("[%d]", n), func(t *testing.T) {
+			diffs := deephash.Diff("", p[0], p[1])
+			if got := deephash.DiffEqual(p[0], p[1]); got != (len(diffs) == 0) {
+				t.Errorf("got %t, want %t (%#v)", got, len(diffs) == 0, diffs)
+			}
+		})
+	}
+}
+
+func TestDiffTo(t *testing.T) {
+	pairs := [][2]interface{}{
+		{"1", "1"},
+		{testStruct{I: 31, S: "1"}, testStruct{I: 32, S: "2", U8: 3}},
+		{map[string]int{"key1": 42}, map[string]int{"key2": 42, "key3": 43}},
+		{[]int{1, 2, 3, 4}, []int{1, 5, 3}},
+	}
+	for n, p := range pairs {
+		t.Run(fmt.Sprintf("[%d]", n), func(t *testing.T) {
+			var out strings.Builder
+			err := deephash.DiffTo(&out, "xyz", p[0], p[1])
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			var lines []string
+			if out.Len() > 0 {
+				lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			}
+			diffs := deephash.Diff("xyz", p[0], p[1])
+			sort.Strings(lines)
+			sort.Strings(diffs)
+			if !reflect.DeepEqual(lines, diffs) {
+				t.Errorf("got %#v, want %#v", lines, diffs)
+			}
+		})
+	}
+
+	fw := &failingWriter{}
+	err := deephash.DiffTo(fw, "xyz", []int{1, 2, 3}, []int{4, 5, 6})
+	if !errors.Is(err, errWriteFailed) {
+		t.Errorf("got %#v, want %#v", err, errWriteFailed)
+	}
+	if fw.calls != 1 {
+		t.Errorf("got %d writes, want writing to stop at the first error", fw.calls)
+	}
+}
+
+var errWriteFailed = errors.New("write failed")
+
+type failingWriter struct {
+	calls int
+}
+
+func (w *failingWriter) Write([]byte) (int, error) {
+	w.calls++
+	return 0, errWriteFailed
+}
+
+func TestDiffNilCollapsed(t *testing.T) {
+	type holder struct {
+		P *testStruct
+		M map[string]*testStruct
+	}
+	full := &testStruct{S: "s", I: 1, Interface: []int{1, 2}}
+
+	testCases := map[string]struct {
+		l, r     interface{}
+		expected []string
+	}{
+		"nil vs value": {
+			l:        nil,
+			r:        full,
+			expected: []string{"xyz is not equal"},
+		},
+		"value vs nil": {
+			l:        full,
+			r:        nil,
+			expected: []string{"xyz is not equal"},
+		},
+		"nil vs map": {
+			l:        nil,
+			r:        map[string]int{"a": 1},
+			expected: []string{"xyz is not equal"},
+		},
+		"map vs nil": {
+			l:        map[string]int{"a": 1},
+			r:        nil,
+			expected: []string{"xyz is not equal"},
+		},
+		"nil field vs value": {
+			l:        holder{},
+			r:        holder{P: full},
+			expected: []string{"xyz.P is not equal"},
+		},
+		"value field vs nil": {
+			l:        holder{P: full, M: map[string]*testStruct{"a": nil}},
+			r:        holder{M: map[string]*testStruct{"a": full}},
+			expected: []string{"xyz.P is not equal", "xyz.M[a] is not equal"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			diffs := deephash.Diff("xyz", tc.l, tc.r)
+			sort.Strings(diffs)
+			expected := append([]string(nil), tc.expected...)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(diffs, expected) {
+				t.Errorf("got %#v, want %#v", diffs, expected)
+			}
+			if count := deephash.DiffCount(tc.l, tc.r); count != len(expected) {
+				t.Errorf("got %d, want %d", count, len(expected))
+			}
+		})
+	}
+}
+
+type Base struct {
+	ID   string
+	Tags []string
+}
+
+type derived struct {
+	*Base
+	Name string
+}
+
+func TestDiffEmbeddedPointer(t *testing.T) {
+	populated := derived{Base: &Base{ID: "1", Tags: []string{"a"}}, Name: "n"}
+	other := derived{Base: &Base{ID: "2", Tags: []string{"a"}}, Name: "n"}
+	empty := derived{Base: &Base{}, Name: "n"}
+	nilBase := derived{Name: "n"}
+
+	testCases := map[string]struct {
+		l, r     derived
+		expected []string
+	}{
+		"promoted field": {
+			l:        populated,
+			r:        other,
+			expected: []string{"xyz.Base.ID is not equal"},
+		},
+		"populated vs nil": {
+			l:        populated,
+			r:        nilBase,
+			expected: []string{"xyz.Base is not equal"},
+		},
+		"nil vs populated": {
+			l:        nilBase,
+			r:        populated,
+			expected: []string{"xyz.Base is not equal"},
+		},
+		"empty vs nil": {
+			l:        empty,
+			r:        nilBase,
+			expected: []string{"xyz.Base is not equal"},
+		},
+		"nil vs nil": {
+			l: nilBase,
+			r: derived{Name: "n"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			diffs := deephash.Diff("xyz", tc.l, tc.r)
+			if !reflect.DeepEqual(diffs, tc.expected) {
+				t.Errorf("got %#v, want %#v", diffs, tc.expected)
+			}
+			if equal := deephash.Hash(tc.l) == deephash.Hash(tc.r); equal != (len(tc.expected) == 0) {
+				t.Errorf("got hashes equal %t, want %t", equal, len(tc.expected) == 0)
+			}
+		})
+	}
+}
+
+// weakHash is fnv64a reduced to a single bit, so that sub-hashes collide
+type weakHash struct {
+	hash.Hash64
+}
+
+func (h weakHash) Sum64() uint64 {
+	return h.Hash64.Sum64() & 1
+}
+
+func TestMapKeyCollisions(t *testing.T) {
+	h := deephash.New(deephash.WithHash64(func() hash.Hash64 {
+		return weakHash{Hash64: fnv.New64a()}
+	}))
+
+	build := func() map[string]int {
+		m := make(map[string]int)
+		for i := 0; i < 50; i++ {
+			m[strconv.Itoa(i)] = i
+		}
+		return m
+	}
+	// The hash itself is reduced to a single bit too, so compare the bytes
+	// written to it
+	first, err := h.Canonical(build())
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	for i := 0; i < 20; i++ {
+		got, err := h.Canonical(build())
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if !bytes.Equal(got, first) {
+			t.Fatalf("got %x, want colliding keys to be written in a stable order %x", got, first)
+		}
+	}
+	diffs, err := h.Diff("xyz", build(), build())
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no spurious differences", diffs)
+	}
+
+	// Pointers to equal values collide with any hash and share a name
+	pointers := func(vals ...int) map[*pointerKey]int {
+		m := make(map[*pointerKey]int)
+		for _, v := range vals {
+			m[&pointerKey{Name: "a"}] = v
+		}
+		return m
+	}
+	ph := deephash.Hash(pointers(1, 2, 3))
+	for i := 0; i < 20; i++ {
+		if got := deephash.Hash(pointers(3, 1, 2)); got != ph {
+			t.Fatalf("got %d, want keys sharing a hash to be ordered by value %d", got, ph)
+		}
+		if diffs := deephash.Diff("xyz", pointers(1, 2, 3), pointers(2, 3, 1)); len(diffs) != 0 {
+			t.Fatalf("got %#v, want no spurious differences", diffs)
+		}
+	}
+	diffs = deephash.Diff("xyz", pointers(1, 2, 3), pointers(1, 2, 4))
+	if len(diffs) == 0 {
+		t.Errorf("want differences between different values")
+	}
+}
+
+func TestMapKeySubHashCollision(t *testing.T) {
+	h := deephash.New(deephash.WithHash64(func() hash.Hash64 {
+		return weakHash{Hash64: fnv.New64a()}
+	}))
+
+	// Find a key whose sub-hash collides with that of "a"
+	other := ""
+	for i := 0; other == ""; i++ {
+		if k := strconv.Itoa(i); mustHash(t, h, k) == mustHash(t, h, "a") {
+			other = k
+		}
+	}
+
+	l, err := h.Canonical(map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	r, err := h.Canonical(map[string]int{other: 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if bytes.Equal(l, r) {
+		t.Errorf("got %x for both, want keys sharing a sub-hash to be written differently", l)
+	}
+
+	diffs, err := h.Diff("xyz", map[string]int{"a": 1}, map[string]int{other: 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) == 0 {
+		t.Errorf("want keys sharing a sub-hash to be reported as different")
+	}
+}
+
+func TestDiffPaths(t *testing.T) {
+	pairs := [][2]interface{}{
+		{"1", "1"},
+		{testStruct{I: 31, S: "1"}, testStruct{I: 32, S: "2", U8: 3}},
+		{map[string]int{"key1": 42, "key2": 1}, map[string]int{"key2": 42, "key3": 43}},
+		{[]int{1, 2, 3, 4}, []int{1, 5, 3}},
+		{nil, &testStruct{}},
+	}
+	for n, p := range pairs {
+		t.Run(fmt.Sprintf("[%d]", n), func(t *testing.T) {
+			paths := deephash.DiffPaths("xyz", p[0], p[1])
+			var expected []string
+			for _, d := range deephash.Diff("xyz", p[0], p[1]) {
+				for _, suffix := range []string{" is not equal", " added", " removed"} {
+					d = strings.TrimSuffix(d, suffix)
+				}
+				expected = append(expected, d)
+			}
+			sort.Strings(paths)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(paths, expected) {
+				t.Errorf("got %#v, want %#v", paths, expected)
+			}
+		})
+	}
+}
+
+func TestDiffNilMapValues(t *testing.T) {
+	withNil := map[string]*testStruct{"k": nil, "j": {S: "j"}}
+	missing := map[string]*testStruct{"j": {S: "j"}}
+	populated := map[string]*testStruct{"k": {S: "k"}, "j": {S: "j"}}
+
+	if deephash.Hash(withNil) == deephash.Hash(missing) {
+		t.Errorf("want a nil value and a missing key to hash differently")
+	}
+
+	for name, tc := range map[string]struct {
+		lSrc, rSrc interface{}
+		expected   []string
+	}{
+		"nil value vs missing key": {
+			lSrc: withNil, rSrc: missing, expected: []string{"xyz[k] removed"},
+		},
+		"missing key vs nil value": {
+			lSrc: missing, rSrc: withNil, expected: []string{"xyz[k] added"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			diffs := deephash.Diff("xyz", tc.lSrc, tc.rSrc)
+			if !reflect.DeepEqual(diffs, tc.expected) {
+				t.Errorf("got %#v, want %#v", diffs, tc.expected)
+			}
+		})
+	}
+
+	for _, diffs := range [][]string{
+		deephash.Diff("xyz", withNil, populated),
+		deephash.Diff("xyz", populated, withNil),
+	} {
+		found := false
+		for _, d := range diffs {
+			if d == "xyz[k] is not equal" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("got %#v, want the nil value to be reported as not equal", diffs)
+		}
+	}
+}
+
+func TestInterfaceMapKeys(t *testing.T) {
+	l := map[interface{}]int{1: 5, "a": 6}
+	r := map[interface{}]int{int8(1): 5, "a": 6}
+
+	if deephash.Hash(l) == deephash.Hash(r) {
+		t.Errorf("want int and int8 keys of the same magnitude to hash differently")
+	}
+	if deephash.Hash(l) != deephash.Hash(map[interface{}]int{"a": 6, 1: 5}) {
+		t.Errorf("want equal interface keyed maps to hash equal")
+	}
+
+	diffs := deephash.Diff("xyz", l, r)
+	sort.Strings(diffs)
+	expected := []string{"xyz[int(1)] removed", "xyz[int8(1)] added"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	diffs = deephash.Diff("xyz", map[int]int{1: 2, 3: 4}, map[int]int{1: 2, 3: 5})
+	expected = []string{"xyz[3] is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestNaNMapKeys(t *testing.T) {
+	l := map[float64]int{math.NaN(): 1, 2: 3}
+	r := map[float64]int{math.NaN(): 2, 2: 3}
+
+	if deephash.Hash(l) == deephash.Hash(r) {
+		t.Errorf("want the values of NaN keys to be hashed")
+	}
+	if deephash.Hash(l) != deephash.Hash(map[float64]int{2: 3, math.NaN(): 1}) {
+		t.Errorf("want equal NaN keyed maps to hash equal")
+	}
+
+	diffs := deephash.Diff("xyz", l, r)
+	expected := []string{"xyz[NaN] is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+	if deephash.DiffEqual(l, r) {
+		t.Errorf("want maps differing at a NaN key not to be equal")
+	}
+	if count := deephash.DiffCount(l, r); count != 1 {
+		t.Errorf("got %d, want 1", count)
+	}
+}
+
+type pointerKey struct {
+	ID   int
+	Name string
+}
+
+func TestPointerMapKeys(t *testing.T) {
+	l := map[*pointerKey]int{{ID: 1, Name: "a"}: 1, {ID: 2, Name: "b"}: 2}
+	r := map[*pointerKey]int{{ID: 1, Name: "a"}: 1, {ID: 2, Name: "b"}: 3}
+
+	if deephash.Hash(l) != deephash.Hash(map[*pointerKey]int{{ID: 2, Name: "b"}: 2, {ID: 1, Name: "a"}: 1}) {
+		t.Errorf("want maps keyed by distinct pointers to equal values to hash equal")
+	}
+
+	expected := []string{"xyz[{2 b}] is not equal"}
+	for i := 0; i < 2; i++ {
+		diffs := deephash.Diff("xyz", l, r)
+		if !reflect.DeepEqual(diffs, expected) {
+			t.Errorf("got %#v, want %#v", diffs, expected)
+		}
+	}
+
+	diffs := deephash.Diff("xyz", map[*pointerKey]int{nil: 1}, map[*pointerKey]int{nil: 2})
+	expected = []string{"xyz[nil] is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestMapKeyTies(t *testing.T) {
+	// The values of each map write the same bytes, but at different paths
+	// as the empty map writes nothing
+	for name, m := range map[string]interface{}{
+		"pointer keys": map[*pointerKey][]interface{}{
+			{ID: 1}: {nil, nil},
+			{ID: 1}: {map[string]int{}, nil, nil},
+		},
+		"NaN keys": map[float64][]interface{}{
+			math.NaN(): {nil, nil},
+			math.NaN(): {map[string]int{}, nil, nil},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 200; i++ {
+				if diffs := deephash.Diff("xyz", m, m); len(diffs) != 0 {
+					t.Fatalf("got %#v, want no differences", diffs)
+				}
+				if !deephash.DiffEqual(m, m) {
+					t.Fatalf("want a map to equal itself")
+				}
+			}
+		})
+	}
+}
+
+func TestDiffStats(t *testing.T) {
+	l := map[string]interface{}{
+		"s":   testStruct{S: "a", I: 1, I8: 2, F32: 3, Interface: "x"},
+		"old": 1,
+	}
+	r := map[string]interface{}{
+		"s":   testStruct{S: "b", I: 2, I8: 2, F32: 4, Interface: "y"},
+		"new": 1,
+	}
+
+	stats := deephash.DiffStats(l, r)
+	expected := map[reflect.Kind]int{
+		reflect.String:  2,
+		reflect.Int:     1,
+		reflect.Float32: 1,
+		reflect.Map:     2,
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("got %#v, want %#v", stats, expected)
+	}
+
+	total := 0
+	for _, n := range stats {
+		total += n
+	}
+	if count := deephash.DiffCount(l, r); total != count {
+		t.Errorf("got %d, want stats to total DiffCount %d", total, count)
+	}
+
+	if stats := deephash.DiffStats(l, l); len(stats) != 0 {
+		t.Errorf("got %#v, want no differences", stats)
+	}
+}
+
 type parent struct {
 	c1, c2 *child
 }
@@ -374,6 +1545,188 @@ func TestStackCycle(t *testing.T) {
 	}
 }
 
+func TestPointerToArray(t *testing.T) {
+	type holder struct {
+		A *[4]int
+	}
+	arr := [4]int{1, 2, 3, 4}
+
+	if deephash.Hash(arr) != deephash.Hash(&arr) {
+		t.Errorf("want an array and a pointer to it to hash equal")
+	}
+
+	nilH := deephash.Hash(holder{})
+	for _, a := range []*[4]int{{}, &arr} {
+		if h := deephash.Hash(holder{A: a}); h == nilH {
+			t.Errorf("got %d, want a nil pointer to an array to differ from %v", h, *a)
+		}
+	}
+	if deephash.Hash(holder{}) != nilH {
+		t.Errorf("want nil pointers to arrays to hash equal")
+	}
+
+	diffs := deephash.Diff("xyz", holder{}, holder{A: &arr})
+	expected := []string{"xyz.A is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	h := deephash.New(deephash.WithSkipNilPointers())
+	skipped, err := h.Hash(holder{})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	empty, err := h.Hash(struct{}{})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if skipped == empty {
+		t.Errorf("got %d, want a struct with a skipped nil pointer not to collide with an empty struct", skipped)
+	}
+}
+
+func TestSharedStructureDifference(t *testing.T) {
+	type leaf struct {
+		Val string
+	}
+	type mid struct {
+		L *leaf
+	}
+	type top struct {
+		A, B *mid
+	}
+
+	shared := &mid{L: &leaf{Val: "x"}}
+	copied := &mid{L: &leaf{Val: "y"}}
+	cases := map[string]struct {
+		l, r     top
+		expected []string
+	}{
+		"shared then copied": {
+			l:        top{A: shared, B: shared},
+			r:        top{A: shared, B: copied},
+			expected: []string{"value.B.L.Val is not equal"},
+		},
+		"copied then shared": {
+			l:        top{A: shared, B: copied},
+			r:        top{A: shared, B: shared},
+			expected: []string{"value.B.L.Val is not equal"},
+		},
+		"shared on both sides": {
+			l:        top{A: shared, B: shared},
+			r:        top{A: copied, B: copied},
+			expected: []string{"value.A.L.Val is not equal", "value.B.L.Val is not equal"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			diffs := deephash.Diff("", c.l, c.r)
+			if !reflect.DeepEqual(diffs, c.expected) {
+				t.Errorf("got %#v, want %#v", diffs, c.expected)
+			}
+			if deephash.Hash(c.l) == deephash.Hash(c.r) {
+				t.Errorf("want values differing below a shared node to hash differently")
+			}
+		})
+	}
+
+	t.Run("cycle", func(t *testing.T) {
+		l := &node{Val: "a"}
+		l.L = &node{Val: "b", L: l}
+		r := &node{Val: "a"}
+		r.L = &node{Val: "c", L: r}
+
+		diffs := deephash.Diff("", l, r)
+		expected := []string{"value.L.Val is not equal"}
+		if !reflect.DeepEqual(diffs, expected) {
+			t.Errorf("got %#v, want %#v", diffs, expected)
+		}
+	})
+}
+
+func BenchmarkDiffCount(b *testing.B) {
+	l := make([]testStruct, 1000)
+	r := make([]testStruct, 1000)
+	for i := range l {
+		l[i] = testStruct{S: "l", I: i, F64: float64(i)}
+		r[i] = testStruct{S: "r", I: -i, F64: float64(i)}
+	}
+
+	b.Run("DiffCount", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = deephash.DiffCount(l, r)
+		}
+	})
+	b.Run("len(Diff)", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = len(deephash.Diff("", l, r))
+		}
+	})
+}
+
+func BenchmarkDiffEqual(b *testing.B) {
+	l := make([]testStruct, 10000)
+	r := make([]testStruct, 10000)
+	for i := range l {
+		l[i] = testStruct{S: "s", I: i, F64: float64(i)}
+		r[i] = l[i]
+	}
+	r[0].S = "early"
+
+	b.Run("DiffEqual", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = deephash.DiffEqual(l, r)
+		}
+	})
+	b.Run("len(Diff)", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = len(deephash.Diff("", l, r)) == 0
+		}
+	})
+}
+
+func BenchmarkHashSmallObject(b *testing.B) {
+	v := &RefA{Id: "test", B: RefB{Id: "anothertest"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = deephash.Hash(v)
+	}
+}
+
+// BenchmarkHashWideDAG hashes directed acyclic graphs of increasing width.
+// Bytes per node should stay flat as the width grows as only the addresses
+// on the current path are tracked for cycle detection.
+func BenchmarkHashWideDAG(b *testing.B) {
+	for _, width := range []int{1000, 10000, 100000} {
+		bottom := make([]*node, width)
+		for i := range bottom {
+			bottom[i] = &node{Val: strconv.Itoa(i)}
+		}
+		middle := make([]*node, width)
+		for i := range middle {
+			middle[i] = &node{L: bottom[i], R: bottom[(i+1)%width]}
+		}
+		top := make([]*node, width)
+		for i := range top {
+			top[i] = &node{L: middle[i], R: middle[(i+1)%width]}
+		}
+
+		b.Run(strconv.Itoa(width), func(b *testing.B) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			for i := 0; i < b.N; i++ {
+				_ = deephash.Hash(top)
+			}
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N*width), "B/node")
+		})
+	}
+}
+
 func BenchmarkHash(b *testing.B) {
 	for n, tc := range differentTestCases {
 		b.Run(fmt.Sprintf("[%d] %#v", n, tc), func(b *testing.B) {
@@ -397,12 +1750,12 @@ func BenchmarkHash(b *testing.B) {
 						fmt.Println(h)
 					}
 				},
-				// "fast deep hash": func(i interface{}) {
-				// 	h := deephash.FastHash(i)
-				// 	if false {
-				// 		fmt.Println(h)
-				// 	}
-				// },
+				"fast deep hash": func(i interface{}) {
+					h := deephash.FastHash(i)
+					if false {
+						fmt.Println(h)
+					}
+				},
 			} {
 				b.Run(name, func(b *testing.B) {
 					for i := 0; i < b.N; i++ {
@@ -413,3 +1766,141 @@ func BenchmarkHash(b *testing.B) {
 		})
 	}
 }
+
+func TestHashObjects(t *testing.T) {
+	a := testStruct{S: "a", I: 1}
+	b := testStruct{S: "b", I: 2}
+	c := "c"
+
+	expected, err := deephash.HashObjects(a, b, c)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	for _, perm := range [][]interface{}{
+		{a, c, b},
+		{b, a, c},
+		{b, c, a},
+		{c, a, b},
+		{c, b, a},
+	} {
+		got, err := deephash.HashObjects(perm...)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if got != expected {
+			t.Errorf("got %d for %#v, want %d", got, perm, expected)
+		}
+	}
+
+	for _, other := range [][]interface{}{
+		{a, b},
+		{a, b, c, c},
+		{a, b, "d"},
+	} {
+		got, err := deephash.HashObjects(other...)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if got == expected {
+			t.Errorf("got %d for %#v, want a different hash", got, other)
+		}
+	}
+}
+
+func BenchmarkDiffDeepStruct(b *testing.B) {
+	l := chain(100, "a")
+	r := chain(100, "b")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = deephash.Diff("", l, r)
+	}
+}
+
+// wideStruct returns a struct with n int fields
+func wideStruct(n int) reflect.Value {
+	fields := make([]reflect.StructField, n)
+	for i := range fields {
+		fields[i] = reflect.StructField{Name: "F" + strconv.Itoa(i), Type: reflect.TypeOf(0)}
+	}
+	v := reflect.New(reflect.StructOf(fields)).Elem()
+	for i := range fields {
+		v.Field(i).SetInt(int64(i))
+	}
+	return v
+}
+
+// BenchmarkHashWideStruct hashes a struct with 50 fields repeatedly
+func BenchmarkHashWideStruct(b *testing.B) {
+	src := wideStruct(50).Interface()
+
+	h := deephash.New()
+	b.Run("Hash", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = h.Hash(src)
+		}
+	})
+	b.Run("Diff", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = h.Diff("", src, src)
+		}
+	})
+}
+
+// BenchmarkHashWideStructArray hashes an array of 1000 structs with 50
+// fields each
+func BenchmarkHashWideStructArray(b *testing.B) {
+	elem := wideStruct(50)
+	arr := reflect.New(reflect.ArrayOf(1000, elem.Type())).Elem()
+	for i := 0; i < arr.Len(); i++ {
+		arr.Index(i).Set(elem)
+	}
+	src := arr.Interface()
+
+	h := deephash.New()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = h.Hash(src)
+	}
+}
+
+func BenchmarkHashConcrete(b *testing.B) {
+	// Any option bypasses the reflection-free path, giving a baseline. No
+	// init bytes leaves the hash itself unchanged.
+	paths := map[string]*deephash.Hasher{
+		"concrete": deephash.New(),
+		"reflect":  deephash.New(deephash.WithInitBytes(nil)),
+	}
+	for name, src := range map[string]interface{}{
+		"string": "foo",
+		"int":    42,
+		"bytes":  []byte("foobarbaz"),
+		"map":    map[string]string{"a": "1", "b": "2", "c": "3"},
+	} {
+		c, cErr := paths["concrete"].Hash(src)
+		r, rErr := paths["reflect"].Hash(src)
+		if cErr != nil || rErr != nil || c != r {
+			b.Fatalf("got %x, %x, want both paths to hash %s equal", c, r, name)
+		}
+		for path, h := range paths {
+			b.Run(name+"/"+path, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_, _ = h.Hash(src)
+				}
+			})
+		}
+	}
+}
+
+// mustHash returns the hash of src using h, failing the test if src can't be
+// hashed
+func mustHash(t *testing.T, h *deephash.Hasher, src interface{}) uint64 {
+	t.Helper()
+	v, err := h.Hash(src)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	return v
+}
@@ -0,0 +1,61 @@
+package deephash
+
+import "reflect"
+
+// Equaler is implemented by types defining their own equality. When both
+// sides of a comparison hold an Equaler of the same type at the same path,
+// Diff and the other comparisons report a single difference at that path if
+// DeepEqual returns false, and nothing otherwise, without comparing the
+// value field by field. DeepEqual is called on the left side with the right
+// side. Equaler doesn't affect hashes.
+type Equaler interface {
+	DeepEqual(other interface{}) bool
+}
+
+// equalerType is the type of Equaler
+var equalerType = reflect.TypeOf((*Equaler)(nil)).Elem()
+
+var (
+	// equalMarker is written in place of an Equaler and of an Equaler
+	// equal to it
+	equalMarker = []byte("\x00equal")
+	// notEqualMarker is written in place of an Equaler not equal to the
+	// Equaler at the same path on the left side
+	notEqualMarker = []byte("\x00notequal")
+)
+
+// compareEqualer writes a marker in place of src and returns true if
+// comparing and src implements Equaler
+func (w *walker) compareEqualer(src reflect.Value) (bool, error) {
+	if w.cw == nil || !src.IsValid() || !src.CanInterface() {
+		return false, nil
+	}
+	switch src.Kind() {
+	case reflect.Interface:
+		// The dynamic value is checked once the interface is dereferenced
+		return false, nil
+	case reflect.Ptr:
+		// Prefer comparing the values pointed to, so that a pointer and a
+		// value can be equal
+		if src.IsNil() || src.Type().Elem().Implements(equalerType) {
+			return false, nil
+		}
+	}
+	e, ok := src.Interface().(Equaler)
+	if !ok {
+		return false, nil
+	}
+
+	field := w.field()
+	if !w.cw.comparing {
+		w.cw.equalers[field] = e
+		return true, w.writeLeaf(reflect.Interface, equalMarker)
+	}
+
+	p := equalMarker
+	l, ok := w.cw.equalers[field]
+	if !ok || reflect.TypeOf(l) != reflect.TypeOf(e) || !l.DeepEqual(e) {
+		p = notEqualMarker
+	}
+	return true, w.writeLeaf(reflect.Interface, p)
+}
@@ -0,0 +1,122 @@
+package deephash_test
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+// money is equal to other money with the same number of cents, whatever
+// its display form
+type money struct {
+	cents   int
+	display string
+}
+
+func (m money) DeepEqual(other interface{}) bool {
+	o, ok := other.(money)
+	return ok && o.cents == m.cents
+}
+
+type invoice struct {
+	ID    string
+	Total money
+	Lines []money
+}
+
+func TestEqualer(t *testing.T) {
+	l := invoice{
+		ID:    "a",
+		Total: money{cents: 150, display: "$1.50"},
+		Lines: []money{{cents: 100, display: "$1"}, {cents: 50, display: "50c"}},
+	}
+	r := invoice{
+		ID:    "a",
+		Total: money{cents: 150, display: "1.50 USD"},
+		Lines: []money{{cents: 100, display: "$1.00"}, {cents: 50, display: "$0.50"}},
+	}
+
+	if diffs := deephash.Diff("xyz", l, r); len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+	if count := deephash.DiffCount(l, r); count != 0 {
+		t.Errorf("got %d, want no differences", count)
+	}
+	if deephash.Hash(l) == deephash.Hash(r) {
+		t.Errorf("want Equaler not to affect the hash")
+	}
+
+	r.Total.cents = 151
+	r.Lines[1].cents = 49
+	diffs := deephash.Diff("xyz", l, r)
+	expected := []string{"xyz.Total is not equal", "xyz.Lines[1] is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	diffs = deephash.Diff("xyz", &l.Total, money{cents: 150})
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+	diffs = deephash.Diff("xyz", money{cents: 150}, nil)
+	expected = []string{"xyz is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+// account dereferences its receiver in each method, so calling one on a nil
+// *account panics
+type account struct {
+	ID int
+}
+
+func (a *account) DeepEqual(other interface{}) bool {
+	o, ok := other.(*account)
+	return ok && o != nil && o.ID == a.ID
+}
+
+func (a *account) String() string {
+	return strconv.Itoa(a.ID)
+}
+
+func TestNilPointerDiff(t *testing.T) {
+	for name, h := range map[string]*deephash.Hasher{
+		"default":        deephash.New(),
+		"stringer":       deephash.New(deephash.WithStringerFallback()),
+		"driver valuers": deephash.New(deephash.WithDriverValuers()),
+		"type changes":   deephash.New(deephash.WithTypeChanges()),
+		"time instants":  deephash.New(deephash.WithTimeInstants()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, tc := range []struct {
+				l, r interface{}
+			}{
+				{(*testStruct)(nil), &testStruct{I: 1}},
+				{&testStruct{I: 1}, (*testStruct)(nil)},
+				{(*account)(nil), &account{ID: 1}},
+				{&account{ID: 1}, (*account)(nil)},
+				{struct{ A *account }{}, struct{ A *account }{A: &account{ID: 1}}},
+				{struct{ A interface{} }{A: &account{ID: 1}}, struct{ A interface{} }{A: (*account)(nil)}},
+			} {
+				diffs, err := h.Diff("xyz", tc.l, tc.r)
+				if err != nil {
+					t.Fatalf("got %#v, want no error", err)
+				}
+				if len(diffs) != 1 {
+					t.Errorf("got %#v, want a single difference for %#v vs %#v", diffs, tc.l, tc.r)
+				}
+
+				details, err := h.DiffDetailed("xyz", tc.l, tc.r)
+				if err != nil {
+					t.Fatalf("got %#v, want no error", err)
+				}
+				if len(details) != 1 || details[0].Change != deephash.Modified {
+					t.Errorf("got %#v, want a single modification", details)
+				}
+			}
+		})
+	}
+}
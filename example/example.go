@@ -22,7 +22,7 @@ func main() {
 		Bar: 43.0,
 	}
 
-	fmt.Printf("String\t%x\n", deephash.Hash(eg1))
-	fmt.Printf("Struct\t%x\n", deephash.Hash(eg2))
-	fmt.Printf("Pointer\t%x\n", deephash.Hash(eg3))
+	fmt.Printf("String\t%x\n", deephash.MustHash(eg1))
+	fmt.Printf("Struct\t%x\n", deephash.MustHash(eg2))
+	fmt.Printf("Pointer\t%x\n", deephash.MustHash(eg3))
 }
@@ -0,0 +1,70 @@
+package deephash
+
+import "reflect"
+
+// DiffByFieldName returns a list of differences between lSrc and rSrc,
+// matching struct fields by name rather than by type
+func DiffByFieldName(lSrc, rSrc interface{}) []string {
+	diffs, err := defaultHasher.DiffByFieldName(lSrc, rSrc)
+	if err != nil {
+		panic(err)
+	}
+	return diffs
+}
+
+// DiffByFieldName returns a list of differences between lSrc and rSrc,
+// which may be structs of different types, for instance a DTO and the
+// domain model it maps to. Fields are matched by name: fields present on
+// both sides are compared like Diff, fields only present in lSrc are
+// reported as removed and fields only present in rSrc as added. Matching
+// fields holding structs of different types are themselves compared by
+// field name. Fields are reported in the order they are declared in lSrc,
+// followed by the fields only present in rSrc.
+//
+// If either lSrc or rSrc isn't a struct, DiffByFieldName is equivalent to
+// Diff.
+func (h *Hasher) DiffByFieldName(lSrc, rSrc interface{}) ([]string, error) {
+	var out []string
+	err := h.diffByFieldName("value", reflect.ValueOf(lSrc), reflect.ValueOf(rSrc), &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// diffByFieldName appends the differences between l and r to out, matching
+// struct fields by name when l and r are structs of different types
+func (h *Hasher) diffByFieldName(field string, l, r reflect.Value, out *[]string) error {
+	li, ri := indirect(l), indirect(r)
+	if li.Kind() != reflect.Struct || ri.Kind() != reflect.Struct || li.Type() == ri.Type() {
+		cw := newCompareWriter()
+		err := h.compareValues(field, l, r, cw)
+		if err != nil {
+			return err
+		}
+		*out = append(*out, cw.diffs...)
+		return nil
+	}
+
+	lt, rt := li.Type(), ri.Type()
+	for i := 0; i < lt.NumField(); i++ {
+		name := lt.Field(i).Name
+		path := appendName(field, name, defaultType)
+		rf, ok := rt.FieldByName(name)
+		if !ok || len(rf.Index) != 1 {
+			*out = append(*out, path+removed)
+			continue
+		}
+		err := h.diffByFieldName(path, li.Field(i), ri.Field(rf.Index[0]), out)
+		if err != nil {
+			return err
+		}
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		name := rt.Field(i).Name
+		if lf, ok := lt.FieldByName(name); !ok || len(lf.Index) != 1 {
+			*out = append(*out, appendName(field, name, defaultType)+added)
+		}
+	}
+	return nil
+}
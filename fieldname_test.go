@@ -0,0 +1,73 @@
+package deephash_test
+
+import (
+	"reflect"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+type userDTO struct {
+	ID      string
+	Name    string
+	Email   string
+	Address addressDTO
+}
+
+type addressDTO struct {
+	Street string
+	City   string
+}
+
+type user struct {
+	ID       string
+	Name     string
+	Address  *address
+	Verified bool
+}
+
+type address struct {
+	City     string
+	Street   string
+	Postcode string
+}
+
+func TestDiffByFieldName(t *testing.T) {
+	dto := userDTO{
+		ID:      "1",
+		Name:    "Ann",
+		Email:   "ann@example.com",
+		Address: addressDTO{Street: "High St", City: "York"},
+	}
+	model := user{
+		ID:      "1",
+		Name:    "Anne",
+		Address: &address{City: "York", Street: "Low St"},
+	}
+
+	diffs := deephash.DiffByFieldName(dto, &model)
+	expected := []string{
+		"value.Name is not equal",
+		"value.Email removed",
+		"value.Address.Street is not equal",
+		"value.Address.Postcode added",
+		"value.Verified added",
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	model.Name = "Ann"
+	model.Address.Street = "High St"
+	diffs = deephash.DiffByFieldName(dto, model)
+	expected = []string{"value.Email removed", "value.Address.Postcode added", "value.Verified added"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	diffs = deephash.DiffByFieldName(testStruct{S: "a"}, testStruct{S: "b"})
+	expected = []string{"value.S is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
@@ -0,0 +1,55 @@
+package deephash
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Fingerprint is the result of hashing a value. It distinguishes hashes from
+// other uint64 values.
+type Fingerprint uint64
+
+// HashFP returns the Fingerprint of src
+func HashFP(src interface{}) (Fingerprint, error) {
+	h, err := HashE(src)
+	if err != nil {
+		return 0, err
+	}
+	return Fingerprint(h), nil
+}
+
+// HashToHex writes the hash of src to out as a zero-padded, 16 character
+// lowercase hex string, the same as Fingerprint.String, without allocating
+// the string
+func HashToHex(out io.Writer, src interface{}) error {
+	h, err := HashE(src)
+	if err != nil {
+		return err
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], h)
+	var x [16]byte
+	hex.Encode(x[:], b[:])
+	_, err = out.Write(x[:])
+	return err
+}
+
+// String returns f as a zero-padded, 16 character lowercase hex string
+func (f Fingerprint) String() string {
+	return FormatHash(uint64(f))
+}
+
+// FormatHash returns h as a zero-padded, 16 character lowercase hex string,
+// so that hashes line up in logs and can be searched for reliably
+func FormatHash(h uint64) string {
+	return fmt.Sprintf("%016x", h)
+}
+
+// Bytes returns f as 8 big-endian bytes
+func (f Fingerprint) Bytes() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(f))
+	return b
+}
@@ -0,0 +1,81 @@
+package deephash_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+func TestHashFP(t *testing.T) {
+	fp, err := deephash.HashFP("foo")
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if uint64(fp) != deephash.Hash("foo") {
+		t.Errorf("got %d, want %d", fp, deephash.Hash("foo"))
+	}
+}
+
+func TestFingerprintString(t *testing.T) {
+	for fp, expected := range map[deephash.Fingerprint]string{
+		0:                  "0000000000000000",
+		0x2a:               "000000000000002a",
+		0xdcb27518fed9d577: "dcb27518fed9d577",
+	} {
+		if got := fp.String(); got != expected {
+			t.Errorf("got %q, want %q", got, expected)
+		}
+	}
+}
+
+func TestFormatHash(t *testing.T) {
+	for h, expected := range map[uint64]string{
+		0:                  "0000000000000000",
+		1:                  "0000000000000001",
+		0xabc:              "0000000000000abc",
+		0xdcb27518fed9d577: "dcb27518fed9d577",
+		^uint64(0):         "ffffffffffffffff",
+	} {
+		if got := deephash.FormatHash(h); got != expected {
+			t.Errorf("got %q, want %q", got, expected)
+		}
+	}
+}
+
+func TestFingerprintBytes(t *testing.T) {
+	for fp, expected := range map[deephash.Fingerprint][]byte{
+		0:                  {0, 0, 0, 0, 0, 0, 0, 0},
+		0x2a:               {0, 0, 0, 0, 0, 0, 0, 0x2a},
+		0xdcb27518fed9d577: {0xdc, 0xb2, 0x75, 0x18, 0xfe, 0xd9, 0xd5, 0x77},
+	} {
+		if got := fp.Bytes(); !bytes.Equal(got, expected) {
+			t.Errorf("got %#v, want %#v", got, expected)
+		}
+	}
+}
+
+func TestHashToHex(t *testing.T) {
+	for _, src := range []interface{}{"foo", 0, testStruct{S: "bar"}, nil} {
+		var b strings.Builder
+		b.WriteString("key:")
+		err := deephash.HashToHex(&b, src)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		fp, err := deephash.HashFP(src)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if expected := "key:" + fp.String(); b.String() != expected {
+			t.Errorf("got %q, want %q", b.String(), expected)
+		}
+	}
+
+	err := deephash.HashToHex(&failingWriter{}, "foo")
+	if !errors.Is(err, errWriteFailed) {
+		t.Errorf("got %#v, want %#v", err, errWriteFailed)
+	}
+}
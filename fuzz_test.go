@@ -0,0 +1,133 @@
+package deephash_test
+
+import (
+	"math"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+type fuzzStruct struct {
+	A, B interface{}
+	P    *fuzzStruct
+}
+
+// fuzzValue builds a value nested at most depth levels deep from data and
+// returns the bytes left over
+func fuzzValue(data []byte, depth int) (interface{}, []byte) {
+	if len(data) == 0 || depth == 0 {
+		return nil, data
+	}
+	op, data := data[0], data[1:]
+	n := int(op>>4) % 4
+	switch op % 8 {
+	case 0:
+		return nil, data
+	case 1:
+		if n > len(data) {
+			n = len(data)
+		}
+		return string(data[:n]), data[n:]
+	case 2:
+		return int(op >> 3), data
+	case 3:
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n && len(data) > 0; i++ {
+			key := string(data[:1])
+			m[key], data = fuzzValue(data[1:], depth-1)
+		}
+		return m, data
+	case 4:
+		s := make([]interface{}, n)
+		for i := range s {
+			s[i], data = fuzzValue(data, depth-1)
+		}
+		return s, data
+	case 5:
+		s := &fuzzStruct{}
+		s.A, data = fuzzValue(data, depth-1)
+		s.B, data = fuzzValue(data, depth-1)
+		if n%2 == 1 {
+			s.P = &fuzzStruct{A: s.A}
+		}
+		return s, data
+	case 6:
+		return (*fuzzStruct)(nil), data
+	default:
+		m := make(map[interface{}]interface{}, n)
+		for i := 0; i < n && len(data) > 0; i++ {
+			var key interface{}
+			switch data[0] % 4 {
+			case 0:
+				key = int(data[0])
+			case 1:
+				key = string(data[:1])
+			case 3:
+				key = math.NaN()
+			}
+			m[key], data = fuzzValue(data[1:], depth-1)
+		}
+		return m, data
+	}
+}
+
+func TestNilMapValue(t *testing.T) {
+	m := map[string]interface{}{"k": nil}
+	if deephash.Hash(m) != deephash.Hash(map[string]interface{}{"k": nil}) {
+		t.Errorf("want nil map values to hash stably")
+	}
+	for _, other := range []interface{}{
+		map[string]interface{}{},
+		map[string]interface{}{"k": ""},
+		map[string]interface{}{"k": 0},
+	} {
+		if deephash.Hash(m) == deephash.Hash(other) {
+			t.Errorf("want a nil map value to differ from %#v", other)
+		}
+	}
+}
+
+func FuzzHashAndDiff(f *testing.F) {
+	f.Add([]byte{3 | 1<<4, 'k', 0})
+	f.Add([]byte{5 | 1<<4, 3 | 2<<4, 'a', 0, 'b', 6, 4 | 3<<4, 0, 2, 1 | 2<<4, 'x', 'y'})
+	f.Add([]byte{7 | 3<<4, 0, 0, 1, 0, 2, 6})
+	f.Add([]byte{7 | 1<<4, 3, 2, 7 | 1<<4, 3, 2 | 1<<3})
+	f.Add([]byte{7 | 2<<4, 3, 6, 3, 4 | 1<<4, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		l, rest := fuzzValue(data, 6)
+		r, _ := fuzzValue(rest, 6)
+
+		lh, err := deephash.HashE(l)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		again, err := deephash.HashE(l)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if again != lh {
+			t.Fatalf("got %d != %d, want the hash to be stable", again, lh)
+		}
+
+		diffs, err := deephash.DiffE("xyz", l, l)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if len(diffs) != 0 {
+			t.Fatalf("got %#v, want no differences comparing %#v with itself", diffs, l)
+		}
+
+		diffs, err = deephash.DiffE("xyz", l, r)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		rh, err := deephash.HashE(r)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if len(diffs) == 0 && lh != rh {
+			t.Fatalf("got no differences, want some as %d != %d", lh, rh)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package deephash
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var (
+	gobEncoderType      = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+)
+
+// writeValue writes src to w, gob encoded when configured with
+// WithGobCanonical and traversed otherwise
+func (h *Hasher) writeValue(w io.Writer, src interface{}) error {
+	if !h.cfg.gobCanonical {
+		return h.traverse(reflect.ValueOf(src), h.cfg.rootField(), noopFieldWriter{w})
+	}
+	t := reflect.TypeOf(src)
+	err := gobDeterministic(t, make(map[reflect.Type]struct{}))
+	if err != nil {
+		return err
+	}
+	b, err := gobValue(src)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, typeID(t)+"\x00")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// gobValue returns the gob encoding of the value of src without the type
+// definitions and type ID preceding it in a gob stream. Type IDs are
+// assigned to types as a process first encodes them, so they differ from one
+// process to the next.
+func gobValue(src interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	// The first message sends the type definitions, so that the second one
+	// only holds the type ID and the value
+	err := enc.Encode(src)
+	if err != nil {
+		return nil, err
+	}
+	buf.Reset()
+	err = enc.Encode(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// The message is prefixed by its length then by the type ID
+	b := buf.Bytes()
+	for i := 0; i < 2; i++ {
+		n := gobUintLen(b)
+		if n == 0 {
+			return nil, fmt.Errorf("malformed gob encoding of %T", src)
+		}
+		b = b[n:]
+	}
+	return b, nil
+}
+
+// gobUintLen returns the number of bytes of the gob encoded unsigned integer
+// at the start of b, or zero if b is too short to hold it. Signed integers
+// are encoded as unsigned integers too.
+func gobUintLen(b []byte) int {
+	switch {
+	case len(b) == 0:
+		return 0
+	case b[0] < 0x80:
+		// Small values are encoded as a single byte
+		return 1
+	}
+	// Otherwise the first byte holds the negated count of the bytes
+	// following it
+	n := 1 + int(-int8(b[0]))
+	if n > len(b) {
+		return 0
+	}
+	return n
+}
+
+// gobDeterministic returns an error if values of type t may be gob encoded
+// differently from one encoding to the next. Maps are encoded in iteration
+// order and interfaces may hold maps, so neither is supported. seen holds
+// the types already checked, which guards against recursive types.
+func gobDeterministic(t reflect.Type, seen map[reflect.Type]struct{}) error {
+	if t == nil {
+		return nil
+	}
+	if _, ok := seen[t]; ok {
+		return nil
+	}
+	seen[t] = struct{}{}
+
+	// Types encoding themselves are trusted to do so deterministically
+	for _, i := range []reflect.Type{gobEncoderType, binaryMarshalerType} {
+		if t.Implements(i) || reflect.PtrTo(t).Implements(i) {
+			return nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Map, reflect.Interface:
+		return fmt.Errorf("%s can't be gob encoded deterministically", t)
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return gobDeterministic(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			// gob ignores unexported fields as well as chan and func fields
+			if f.PkgPath != "" || f.Type.Kind() == reflect.Chan || f.Type.Kind() == reflect.Func {
+				continue
+			}
+			err := gobDeterministic(f.Type, seen)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
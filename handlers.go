@@ -0,0 +1,207 @@
+package deephash
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// handler returns the value to traverse in place of v. It is only called
+// with values that can be converted to an interface{} and aren't nil.
+type handler func(v reflect.Value) (reflect.Value, error)
+
+// builtinHandlers substitute values of specific types whose fields don't
+// reflect their identity with a canonical form
+var builtinHandlers = map[reflect.Type]handler{
+	reflect.TypeOf(url.URL{}): func(v reflect.Value) (reflect.Value, error) {
+		u := v.Interface().(url.URL)
+		return reflect.ValueOf(u.String()), nil
+	},
+}
+
+// interfaceHandler substitutes values of any type implementing iface
+type interfaceHandler struct {
+	iface reflect.Type
+	h     handler
+}
+
+// builtinInterfaceHandlers are consulted, in order, for values without a
+// handler in builtinHandlers
+var builtinInterfaceHandlers = []interfaceHandler{
+	{
+		// reflect.Type values hold unexported internals, so hash them by
+		// their type ID instead
+		iface: reflect.TypeOf((*reflect.Type)(nil)).Elem(),
+		h: func(v reflect.Value) (reflect.Value, error) {
+			return reflect.ValueOf(typeID(v.Interface().(reflect.Type))), nil
+		},
+	},
+}
+
+// isAtomic returns true when t is one of the sync/atomic types, such as
+// atomic.Value or atomic.Int64, with a Load method
+func isAtomic(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t.PkgPath() != "sync/atomic" {
+		return false
+	}
+	m, ok := reflect.PtrTo(t).MethodByName("Load")
+	return ok && m.Type.NumIn() == 1 && m.Type.NumOut() == 1
+}
+
+// atomicHandler substitutes a sync/atomic value with its current value as
+// returned by Load. The atomic types only expose Load via a pointer, so
+// values that aren't addressable are copied first.
+func atomicHandler(v reflect.Value) (reflect.Value, error) {
+	if !v.CanAddr() {
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		v = c
+	}
+	return v.Addr().MethodByName("Load").Call(nil)[0], nil
+}
+
+// rawMessageType is the type of json.RawMessage
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// compactJSONHandler substitutes a json.RawMessage with its compacted form.
+// Messages that aren't valid JSON are substituted with their bytes as is.
+func compactJSONHandler(v reflect.Value) (reflect.Value, error) {
+	raw := v.Bytes()
+	var buf bytes.Buffer
+	err := json.Compact(&buf, raw)
+	if err != nil {
+		return reflect.ValueOf([]byte(raw)), nil
+	}
+	return reflect.ValueOf(buf.Bytes()), nil
+}
+
+// timeType is the type of time.Time
+var timeType = reflect.TypeOf(time.Time{})
+
+// timeInstantHandler substitutes a time.Time with the instant it represents
+// formatted in UTC, which drops its location and monotonic clock reading
+func timeInstantHandler(v reflect.Value) (reflect.Value, error) {
+	return reflect.ValueOf(v.Interface().(time.Time).UTC().Format(time.RFC3339Nano)), nil
+}
+
+// durationType is the type of time.Duration
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// durationStringHandler substitutes a time.Duration with its String form
+func durationStringHandler(v reflect.Value) (reflect.Value, error) {
+	return reflect.ValueOf(v.Interface().(time.Duration).String()), nil
+}
+
+// valuerType is the type of driver.Valuer
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// valuerHandler substitutes a driver.Valuer with its driver value
+func valuerHandler(v reflect.Value) (reflect.Value, error) {
+	dv, err := v.Interface().(driver.Valuer).Value()
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(dv), nil
+}
+
+// gobEncoderHandler substitutes a gob.GobEncoder with the bytes returned by
+// its GobEncode method
+func gobEncoderHandler(v reflect.Value) (reflect.Value, error) {
+	b, err := v.Interface().(gob.GobEncoder).GobEncode()
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(b), nil
+}
+
+// stringerType is the type of fmt.Stringer
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// stringerHandler substitutes a fmt.Stringer with the result of its String
+// method. The result is a plain string, which is never handled again, so a
+// String method can't cause the traversal to recurse.
+func stringerHandler(v reflect.Value) (reflect.Value, error) {
+	return reflect.ValueOf(v.Interface().(fmt.Stringer).String()), nil
+}
+
+// handlerFor returns the handler for values of type t or nil if there is
+// none. The handler for each type is looked up once per Hasher.
+func (w *walker) handlerFor(t reflect.Type) handler {
+	if w.cfg.handlers == nil {
+		return w.findHandler(t)
+	}
+	if h, ok := w.cfg.handlers.Load(t); ok {
+		return h.(handler)
+	}
+	h := w.findHandler(t)
+	w.cfg.handlers.Store(t, h)
+	return h
+}
+
+// findHandler returns the handler for values of type t or nil if there is
+// none
+func (w *walker) findHandler(t reflect.Type) handler {
+	if h, ok := builtinHandlers[t]; ok {
+		return h
+	}
+	if isAtomic(t) {
+		return atomicHandler
+	}
+	if w.cfg.compactJSON && t == rawMessageType {
+		return compactJSONHandler
+	}
+	if w.cfg.timeInstants && t == timeType {
+		return timeInstantHandler
+	}
+	if w.cfg.durationStrings && t == durationType {
+		return durationStringHandler
+	}
+	if w.cfg.driverValuers && t.Implements(valuerType) {
+		return valuerHandler
+	}
+	if w.cfg.gobEncoders && t.Implements(gobEncoderType) {
+		return gobEncoderHandler
+	}
+	for _, ih := range builtinInterfaceHandlers {
+		if t.Implements(ih.iface) {
+			return ih.h
+		}
+	}
+	if w.cfg.stringerFallback && t.Implements(stringerType) {
+		return stringerHandler
+	}
+	return nil
+}
+
+// handle traverses the substitute for src and returns true if src has a
+// handler. Values that can't be converted to an interface{}, such as those
+// reached through unexported fields, are never handled and fall back to
+// being traversed field by field.
+func (w *walker) handle(src reflect.Value) (bool, error) {
+	if !src.IsValid() || !src.CanInterface() {
+		return false, nil
+	}
+	h := w.handlerFor(src.Type())
+	if h == nil {
+		return false, nil
+	}
+	if (src.Kind() == reflect.Ptr || src.Kind() == reflect.Interface) && src.IsNil() {
+		return false, nil
+	}
+
+	sub, err := h(src)
+	if err != nil {
+		return true, err
+	}
+	if sub.IsValid() && sub.Type() == src.Type() {
+		// Guards against a handler substituting a value that would be
+		// handled again
+		return false, nil
+	}
+	return true, w.deepHash(sub)
+}
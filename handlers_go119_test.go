@@ -0,0 +1,47 @@
+//go:build go1.19
+
+package deephash_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+type counters struct {
+	Hits    atomic.Int64
+	Enabled atomic.Bool
+	Last    atomic.Pointer[string]
+}
+
+func TestAtomicTypes(t *testing.T) {
+	a, b := &counters{}, &counters{}
+	a.Hits.Add(3)
+	b.Hits.Store(3)
+	if deephash.Hash(a) != deephash.Hash(b) {
+		t.Errorf("want atomics holding the same values to hash equal")
+	}
+	if deephash.Hash(&a.Hits) != deephash.Hash(int64(3)) {
+		t.Errorf("want an atomic.Int64 to hash as its current value")
+	}
+
+	a.Enabled.Store(true)
+	if deephash.Hash(a) == deephash.Hash(b) {
+		t.Errorf("want atomics holding different values to hash differently")
+	}
+	b.Enabled.Store(true)
+
+	la, lb := "last", "last"
+	a.Last.Store(&la)
+	b.Last.Store(&lb)
+	if deephash.Hash(a) != deephash.Hash(b) {
+		t.Errorf("want atomic pointers to equal values to hash equal")
+	}
+
+	b.Hits.Add(1)
+	diffs := deephash.Diff("xyz", a, b)
+	if len(diffs) != 1 || diffs[0] != "xyz.Hits is not equal" {
+		t.Errorf("got %#v, want only Hits to differ", diffs)
+	}
+}
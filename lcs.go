@@ -0,0 +1,195 @@
+package deephash
+
+import "reflect"
+
+const (
+	inserted = " inserted"
+	deleted  = " deleted"
+)
+
+// maxLCSCells bounds the size of the table used to align elements, which
+// holds a cell for each pair of elements left once those common to the start
+// and end of both sides are trimmed
+const maxLCSCells = 1 << 20
+
+// DiffSlicesLCS returns a list of differences between the slices or arrays
+// lSrc and rSrc, aligning their elements via a longest common subsequence
+func DiffSlicesLCS(field string, lSrc, rSrc interface{}) []string {
+	diffs, err := defaultHasher.DiffSlicesLCS(field, lSrc, rSrc)
+	if err != nil {
+		panic(err)
+	}
+	return diffs
+}
+
+// DiffSlicesLCS returns a list of differences between the slices or arrays
+// lSrc and rSrc. Rather than comparing index by index, elements are aligned
+// via a longest common subsequence of their hashes so that inserting an
+// element at the front of a slice is reported as a single insertion instead
+// of a difference at every index. Inserted elements are reported by their
+// index in rSrc and deleted elements by their index in lSrc. A deleted
+// element immediately replaced by an inserted element is compared field by
+// field. A moved element is reported as deleted at its old index and
+// inserted at its new index.
+//
+// Elements equal at the start and end of both sides are skipped. Aligning
+// the n elements left on each side takes memory and time proportional to
+// n², so beyond about a thousand elements on each side they are compared
+// index by index instead.
+//
+// If either lSrc or rSrc isn't a slice or an array, DiffSlicesLCS is
+// equivalent to Diff.
+func (h *Hasher) DiffSlicesLCS(field string, lSrc, rSrc interface{}) ([]string, error) {
+	if field == "" {
+		field = "value"
+	}
+
+	l := indirect(reflect.ValueOf(lSrc))
+	r := indirect(reflect.ValueOf(rSrc))
+	if !isList(l) || !isList(r) {
+		return h.Diff(field, lSrc, rSrc)
+	}
+
+	lh, err := h.elementHashes(field, l)
+	if err != nil {
+		return nil, err
+	}
+	rh, err := h.elementHashes(field, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Elements common to the start and end of both sides are equal, so only
+	// the elements between them need aligning
+	start := 0
+	for start < len(lh) && start < len(rh) && lh[start] == rh[start] {
+		start++
+	}
+	lEnd, rEnd := len(lh), len(rh)
+	for lEnd > start && rEnd > start && lh[lEnd-1] == rh[rEnd-1] {
+		lEnd--
+		rEnd--
+	}
+	lm, rm := lh[start:lEnd], rh[start:rEnd]
+	aligned := len(lm) == 0 || len(rm) <= maxLCSCells/len(lm)
+
+	// lengths[i][j] holds the length of the longest common subsequence of
+	// lm[i:] and rm[j:]
+	var lengths [][]int
+	if aligned {
+		lengths = make([][]int, len(lm)+1)
+		for i := range lengths {
+			lengths[i] = make([]int, len(rm)+1)
+		}
+		for i := len(lm) - 1; i >= 0; i-- {
+			for j := len(rm) - 1; j >= 0; j-- {
+				switch {
+				case lm[i] == rm[j]:
+					lengths[i][j] = lengths[i+1][j+1] + 1
+				case lengths[i+1][j] >= lengths[i][j+1]:
+					lengths[i][j] = lengths[i+1][j]
+				default:
+					lengths[i][j] = lengths[i][j+1]
+				}
+			}
+		}
+	}
+
+	var dels, ins []int
+	var out []string
+	flush := func() error {
+		paired := len(dels)
+		if len(ins) < paired {
+			paired = len(ins)
+		}
+		for k := 0; k < paired; k++ {
+			cw := newCompareWriter()
+			name := h.cfg.indexPath(field, ins[k])
+			err := h.compareValues(name, l.Index(dels[k]), r.Index(ins[k]), cw)
+			if err != nil {
+				return err
+			}
+			out = append(out, cw.diffs...)
+		}
+		for _, i := range dels[paired:] {
+			out = append(out, h.cfg.indexPath(field, i)+deleted)
+		}
+		for _, j := range ins[paired:] {
+			out = append(out, h.cfg.indexPath(field, j)+inserted)
+		}
+		dels, ins = dels[:0], ins[:0]
+		return nil
+	}
+
+	if !aligned {
+		// Too many elements differ to align them, so they are compared
+		// index by index
+		for i := start; i < lEnd; i++ {
+			dels = append(dels, i)
+		}
+		for j := start; j < rEnd; j++ {
+			ins = append(ins, j)
+		}
+	}
+	i, j := 0, 0
+	for aligned && (i < len(lm) || j < len(rm)) {
+		switch {
+		case i < len(lm) && j < len(rm) && lm[i] == rm[j]:
+			err := flush()
+			if err != nil {
+				return nil, err
+			}
+			i++
+			j++
+		case j < len(rm) && (i == len(lm) || lengths[i][j+1] >= lengths[i+1][j]):
+			ins = append(ins, start+j)
+			j++
+		default:
+			dels = append(dels, start+i)
+			i++
+		}
+	}
+	err = flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// elementHashes returns the hash of each element of the slice or array src
+// named field
+func (h *Hasher) elementHashes(field string, src reflect.Value) (hashes []uint64, err error) {
+	w := h.walker(noopFieldWriter{})
+	defer w.release()
+	if h.cfg.recoverPanics {
+		defer w.recoverPanic(&err)
+	}
+	w.named = true
+	w.name = append(w.name, field...)
+	hashes = make([]uint64, src.Len())
+	for i := range hashes {
+		prev := w.pushIndex(i)
+		eh, err := w.subHash(src.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		w.popName(prev)
+		hashes[i] = eh
+	}
+	return hashes, nil
+}
+
+// indirect follows pointers and interfaces until reaching a value that is
+// neither
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	return v
+}
+
+// isList returns true when v is a slice or an array
+func isList(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+}
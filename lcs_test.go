@@ -0,0 +1,94 @@
+package deephash_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+func TestDiffSlicesLCS(t *testing.T) {
+	for name, tc := range map[string]struct {
+		lSrc, rSrc interface{}
+		expected   []string
+	}{
+		"equal": {
+			lSrc: []string{"a", "b", "c"},
+			rSrc: []string{"a", "b", "c"},
+		},
+		"insert at front": {
+			lSrc:     []string{"a", "b", "c"},
+			rSrc:     []string{"z", "a", "b", "c"},
+			expected: []string{"xyz[0] inserted"},
+		},
+		"insert in middle": {
+			lSrc:     []int{1, 2, 3},
+			rSrc:     []int{1, 2, 9, 3},
+			expected: []string{"xyz[2] inserted"},
+		},
+		"delete": {
+			lSrc:     []int{1, 2, 3, 4},
+			rSrc:     []int{1, 3, 4},
+			expected: []string{"xyz[1] deleted"},
+		},
+		"move": {
+			lSrc:     []string{"a", "b", "c", "d"},
+			rSrc:     []string{"b", "c", "d", "a"},
+			expected: []string{"xyz[0] deleted", "xyz[3] inserted"},
+		},
+		"replace": {
+			lSrc: []testStruct{{S: "a"}, {S: "b", I: 1}, {S: "c"}},
+			rSrc: []testStruct{{S: "z"}, {S: "a"}, {S: "b", I: 2}, {S: "c"}},
+			expected: []string{
+				"xyz[0] inserted",
+				"xyz[2].I is not equal",
+			},
+		},
+		"arrays and pointers": {
+			lSrc:     &[3]int{1, 2, 3},
+			rSrc:     []int{0, 1, 2, 3},
+			expected: []string{"xyz[0] inserted"},
+		},
+		"not slices": {
+			lSrc:     testStruct{S: "a"},
+			rSrc:     testStruct{S: "b"},
+			expected: []string{"xyz.S is not equal"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			diffs := deephash.DiffSlicesLCS("xyz", tc.lSrc, tc.rSrc)
+			sort.Strings(diffs)
+			sort.Strings(tc.expected)
+			if len(diffs) != 0 || len(tc.expected) != 0 {
+				if !reflect.DeepEqual(diffs, tc.expected) {
+					t.Errorf("got %#v, want %#v", diffs, tc.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffSlicesLCSLong(t *testing.T) {
+	l := make([]int, 10000)
+	for i := range l {
+		l[i] = i
+	}
+
+	r := append(append(append([]int{}, l[:5000]...), -1), l[5000:]...)
+	diffs := deephash.DiffSlicesLCS("xyz", l, r)
+	expected := []string{"xyz[5000] inserted"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	// Too many elements differ to align them
+	r = make([]int, len(l)+1)
+	for i := range l {
+		r[i] = -i - 1
+	}
+	diffs = deephash.DiffSlicesLCS("xyz", l, r)
+	if len(diffs) != len(r) || diffs[0] != "xyz[0] is not equal" || diffs[len(l)] != "xyz[10000] inserted" {
+		t.Errorf("got %d differences starting %#v, want %d compared index by index", len(diffs), diffs[:2], len(r))
+	}
+}
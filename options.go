@@ -0,0 +1,895 @@
+package deephash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// defaultHasher is used by the package level functions
+var defaultHasher = New()
+
+// Option configures a Hasher
+type Option func(*config)
+
+// config holds the settings applied by each Option
+type config struct {
+	kindTags           bool
+	sortedSlices       bool
+	structureSensitive bool
+	typeNames          bool
+	mapKeyLess         func(a, b reflect.Value) bool
+	numericCanonical   bool
+	normalizeString    func(string) string
+	runeStrings        bool
+	byteStrings        bool
+	initBytes          []byte
+	skipNilPointers    bool
+	byteFastPath       bool
+	primitiveFastPath  bool
+	containerTags      bool
+	fieldNameMapper    func(goName string) string
+	maxDepth           int
+	maxDepthError      bool
+	floatFormatter     func(f float64) []byte
+	versionPrefix      bool
+	driverValuers      bool
+	gobEncoders        bool
+	lengthPrefix       bool
+	stringerFallback   bool
+	schemaFingerprint  bool
+	compactJSON        bool
+	hash64             func() hash.Hash64
+	seed               []byte
+	typeIdentity       bool
+	floatScale         float64
+	skipTypes          map[reflect.Type]struct{}
+	timeInstants       bool
+	durationStrings    bool
+	maxFields          int
+	indexFormat        func(i int) string
+	mapValuesOnly      bool
+	gobCanonical       bool
+	typeChanges        bool
+	recoverPanics      bool
+	elementLimit       int
+	distinctEmpty      bool
+	memoizeShared      bool
+	// handlers caches the handler, or nil handler, for each reflect.Type
+	// traversed
+	handlers *sync.Map
+	// plans caches the fieldPlan of each struct type traversed
+	plans *sync.Map
+}
+
+// newHash returns a new hash using the configured backend, keyed with the
+// configured seed
+func (c *config) newHash() hash.Hash64 {
+	var h hash.Hash64
+	if c.hash64 != nil {
+		h = c.hash64()
+	} else {
+		h = fnv.New64a()
+	}
+	// Writing to a hash never fails
+	_, _ = h.Write(c.seed)
+	return h
+}
+
+// writeHeader writes the bytes written before any value is traversed
+func (c *config) writeHeader(w io.Writer, prefix []byte) error {
+	if c.versionPrefix {
+		_, err := fmt.Fprintf(w, "deephash:v%d\x00", AlgorithmVersion)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(prefix)
+	return err
+}
+
+// rootField returns the name of the root of a hashing traversal. Paths are
+// only computed when some option needs them.
+func (c *config) rootField() string {
+	if c.maxDepthError {
+		return "value"
+	}
+	return ""
+}
+
+// WithKindTags prefixes each leaf value with a single byte identifying its
+// reflect.Kind so that, for example, an int64 and a float64 sharing the same
+// bits or a string sharing the same bytes no longer hash to the same value
+func WithKindTags() Option {
+	return func(c *config) {
+		c.kindTags = true
+	}
+}
+
+// WithSortedSlices hashes each element of a slice or array of comparable
+// elements on its own and then hashes the element hashes in sorted order, so
+// slices holding the same elements in a different order hash equal. The
+// caller's slice is not modified. Unlike set semantics, duplicates are
+// retained: []int{1, 1, 2} and []int{1, 2} still hash differently. In Diff,
+// indexes refer to positions in the sorted order rather than the original
+// slice.
+func WithSortedSlices() Option {
+	return func(c *config) {
+		c.sortedSlices = true
+	}
+}
+
+// WithMapValuesOnly hashes each map as the multiset of its values, ignoring
+// its keys entirely: each value is hashed on its own and the value hashes
+// are hashed in sorted order. Maps holding the same values under different
+// keys, such as map[string]int{"a": 1} and map[string]int{"b": 1}, hash
+// equal, and a change of key alone is never detected. As with
+// WithSortedSlices, Diff reports differing values by their index in the
+// sorted order, such as "value[0]", rather than by their key.
+func WithMapValuesOnly() Option {
+	return func(c *config) {
+		c.mapValuesOnly = true
+	}
+}
+
+// WithStructureSensitive makes the shape of the traversed object graph
+// significant. By default, two pointers to the same value hash the same as
+// two pointers to distinct but equal values. With this option, a pointer
+// that has already been traversed is written as a reference to its first
+// occurrence instead of being traversed again, so shared and copied values
+// hash differently. Values hashed on their own, such as map keys and
+// elements sorted by WithSortedSlices, track their pointers separately.
+func WithStructureSensitive() Option {
+	return func(c *config) {
+		c.structureSensitive = true
+	}
+}
+
+// WithTypeNames annotates diff paths with the dynamic type of each value
+// held in an interface, for instance "value.Interface(testStruct).I". It
+// doesn't affect hashes.
+func WithTypeNames() Option {
+	return func(c *config) {
+		c.typeNames = true
+	}
+}
+
+// WithMapKeyOrder orders map entries using less rather than by the hash of
+// their keys, for instance to visit keys in their natural numeric or
+// lexicographic order. This makes the order of differences reported by Diff
+// predictable. Keys that less considers equal keep their hash order, so
+// hashes remain deterministic as long as less is a strict weak ordering.
+func WithMapKeyOrder(less func(a, b reflect.Value) bool) Option {
+	return func(c *config) {
+		c.mapKeyLess = less
+	}
+}
+
+// WithNumericCanonical hashes every signed integer, unsigned integer and
+// float as the float64 of the same value, so that, for instance, int(42),
+// uint(42) and float64(42) hash equal. This suits loosely typed data such as
+// JSON decoded into interface{} values. Negative zero hashes as zero and
+// every NaN hashes the same.
+//
+// Integers with a magnitude greater than 2^53 can't be represented exactly
+// by a float64, so neighbouring large int64 and uint64 values may hash
+// equal.
+func WithNumericCanonical() Option {
+	return func(c *config) {
+		c.numericCanonical = true
+	}
+}
+
+// WithStringNormalization applies normalize to every string, including map
+// keys, before it is hashed. For instance, passing norm.NFC.String from
+// golang.org/x/text/unicode/norm makes canonically equivalent strings hash
+// equal even when they are composed of different code points.
+func WithStringNormalization(normalize func(string) string) Option {
+	return func(c *config) {
+		c.normalizeString = normalize
+	}
+}
+
+// WithRuneStringEquivalence hashes []rune and []byte slices (including any
+// slice of int32 or uint8) as the equivalent string, so []rune("abc"),
+// []byte("abc") and "abc" hash equal. A []byte holding binary data rather
+// than text is converted as is, which means it hashes equal to a string
+// holding the same bytes, even if that string isn't valid UTF-8. Arrays
+// aren't converted.
+func WithRuneStringEquivalence() Option {
+	return func(c *config) {
+		c.runeStrings = true
+	}
+}
+
+// WithInitBytes writes b to the hash before any value is traversed,
+// effectively namespacing every hash produced by the Hasher
+func WithInitBytes(b []byte) Option {
+	return func(c *config) {
+		c.initBytes = append(c.initBytes[:0:0], b...)
+	}
+}
+
+// WithSkipNilPointers skips nil pointers, interfaces and other nil values
+// entirely rather than writing a nil marker. A struct with an unset optional
+// pointer field then hashes equal to one without that field and Diff
+// doesn't report the unset field.
+func WithSkipNilPointers() Option {
+	return func(c *config) {
+		c.skipNilPointers = true
+	}
+}
+
+// WithByteSliceAsString hashes byte slices (including any slice of uint8)
+// as the equivalent string, so []byte("abc") and "abc" hash equal, for
+// protocols where the two are interchangeable. Like WithByteFastPath, the
+// bytes are written as a single leaf without being converted first. A
+// []byte holding binary data rather than text hashes equal to a string
+// holding the same bytes, even if that string isn't valid UTF-8. Arrays
+// aren't affected.
+func WithByteSliceAsString() Option {
+	return func(c *config) {
+		c.byteStrings = true
+	}
+}
+
+// WithByteFastPath hashes byte slices and arrays as a single leaf rather
+// than one leaf per byte, which is much faster for large values. When
+// hashing, the bytes are written in chunks so that large arrays are never
+// copied in one go; the chunk boundaries don't affect the hash. Diff reports
+// a differing byte slice or array once rather than at every differing index.
+func WithByteFastPath() Option {
+	return func(c *config) {
+		c.byteFastPath = true
+	}
+}
+
+// WithPrimitiveFastPath encodes slices and arrays of integers and floats in
+// bulk rather than traversing them element by element, which is much faster
+// for large values. Each element is still written as the same 8 bytes, so
+// hashes are unchanged. Elements are traversed one by one as before when
+// their type has a handler or is skipped, and with any option that changes
+// how elements are framed or encoded: container tags, kind tags, type
+// identity, canonical numbers, stable floats and float formatters. Diff and
+// HashPartial also traverse elements one by one as they need their paths.
+func WithPrimitiveFastPath() Option {
+	return func(c *config) {
+		c.primitiveFastPath = true
+	}
+}
+
+// WithContainerTags writes a byte identifying the kind of container (slice,
+// array or map) before each element, so that, for instance, a map and a
+// slice whose elements happen to produce the same bytes don't collide. With
+// this option, slices and arrays with equal contents no longer hash equal.
+// Container tags only affect hashes; Diff paths already distinguish map keys
+// from indexes.
+func WithContainerTags() Option {
+	return func(c *config) {
+		c.containerTags = true
+	}
+}
+
+// WithFieldNameMapper renames struct fields in diff paths, for instance to
+// report snake_case names. mapper is passed the Go name of each field. It
+// doesn't affect hashes.
+func WithFieldNameMapper(mapper func(goName string) string) Option {
+	return func(c *config) {
+		c.fieldNameMapper = mapper
+	}
+}
+
+// WithIndexFormat renders the indexes of slice and array elements in diff
+// paths using format, for instance to zero-pad them. The result is placed
+// between the brackets, so an index formatted as "007" is reported as
+// "value[007]". It doesn't affect hashes.
+func WithIndexFormat(format func(i int) string) Option {
+	return func(c *config) {
+		c.indexFormat = format
+	}
+}
+
+// WithMaxDepth stops traversing values nested more than n levels deep,
+// writing a marker in their place. Values differing only below the maximum
+// depth hash equal.
+func WithMaxDepth(n int) Option {
+	return func(c *config) {
+		c.maxDepth = n
+		c.maxDepthError = false
+	}
+}
+
+// WithMaxDepthError returns an error wrapping ErrMaxDepthExceeded, including
+// the path of the offending value, when traversing a value nested more than
+// n levels deep
+func WithMaxDepthError(n int) Option {
+	return func(c *config) {
+		c.maxDepth = n
+		c.maxDepthError = true
+	}
+}
+
+// WithFloatFormatter writes floats using format rather than as the 8
+// big-endian bytes of their IEEE 754 representation, for instance to make
+// the output of Canonical human readable. A nil format writes the shortest
+// decimal form that represents the float exactly, as returned by
+// strconv.AppendFloat(nil, f, 'g', -1, 64). Changing the formatter changes
+// every hash involving a float. Together with WithNumericCanonical, integers
+// are formatted as floats too.
+func WithFloatFormatter(format func(f float64) []byte) Option {
+	return func(c *config) {
+		if format == nil {
+			format = decimalFloat
+		}
+		c.floatFormatter = format
+	}
+}
+
+// decimalFloat returns the shortest decimal form of f
+func decimalFloat(f float64) []byte {
+	return strconv.AppendFloat(nil, f, 'g', -1, 64)
+}
+
+// WithVersionPrefix writes AlgorithmVersion before any value is traversed
+// (and before any bytes set by WithInitBytes), so that hashes produced by
+// different versions of the algorithm never match, even for inputs whose
+// hash wouldn't otherwise have changed
+func WithVersionPrefix() Option {
+	return func(c *config) {
+		c.versionPrefix = true
+	}
+}
+
+// WithGobEncoders hashes values implementing gob.GobEncoder as the bytes
+// returned by their GobEncode method, for types whose fields don't reflect
+// their identity but which encode themselves canonically. The bytes are
+// hashed like any []byte, so as a single leaf with WithByteFastPath. An
+// error returned by GobEncode is returned by Hash and Diff. Driver values
+// take precedence when combined with WithDriverValuers.
+func WithGobEncoders() Option {
+	return func(c *config) {
+		c.gobEncoders = true
+	}
+}
+
+// WithDriverValuers hashes values implementing database/sql/driver.Valuer,
+// such as sql.NullString, as the driver value returned by their Value
+// method. Invalid null values then hash equal regardless of their unused
+// fields, and valid ones hash like the value they hold, so
+// sql.NullString{String: "a", Valid: true} hashes like "a". An error
+// returned by Value is returned by Hash and Diff.
+func WithDriverValuers() Option {
+	return func(c *config) {
+		c.driverValuers = true
+	}
+}
+
+// WithLengthPrefix writes the number of elements of every slice, array and
+// map before its elements, so that collections can't collide with other
+// values whose bytes happen to continue where the collection ends. Diff
+// reports a change of length as a difference at the path of the collection,
+// in addition to the differing elements.
+func WithLengthPrefix() Option {
+	return func(c *config) {
+		c.lengthPrefix = true
+	}
+}
+
+// WithStringerFallback hashes values implementing fmt.Stringer as the
+// string returned by their String method rather than field by field, for
+// types such as enums and IDs whose identity is their string form. Values
+// with a built-in handler, such as url.URL, or handled by another option
+// like WithDriverValuers, aren't affected. Diff reports a differing Stringer
+// once at its path. A String method may hash its receiver, but only with a
+// Hasher configured without this option: hashing it with the same Hasher
+// calls String again until the stack overflows, which is fatal even with
+// WithRecoverPanics.
+func WithStringerFallback() Option {
+	return func(c *config) {
+		c.stringerFallback = true
+	}
+}
+
+// WithSchemaFingerprint writes a fingerprint of the structure of the type of
+// the value being hashed before traversing it. The fingerprint covers the
+// names and types of the fields of every struct reachable from that type, so
+// changing the layout of a struct, for instance adding a field, changes the
+// hash of every value of the struct, even values that hash equal without the
+// option. The fingerprint is of the static types only: the dynamic types
+// held in interfaces are not included. It doesn't affect Diff.
+func WithSchemaFingerprint() Option {
+	return func(c *config) {
+		c.schemaFingerprint = true
+	}
+}
+
+// WithCompactJSON hashes each json.RawMessage as its compacted form, with
+// insignificant whitespace removed, so that the same JSON document formatted
+// differently hashes equal. The message is hashed as a []byte, so this is
+// best combined with WithByteFastPath. Compacting parses and copies every
+// message, which costs roughly as much as hashing it again. Object keys keep
+// their order, so documents whose keys are ordered differently still hash
+// differently. Messages that aren't valid JSON are hashed as is.
+func WithCompactJSON() Option {
+	return func(c *config) {
+		c.compactJSON = true
+	}
+}
+
+// WithHash64 uses the hashes returned by newHash in place of fnv64a, both
+// for the hash returned and for the hashes of individual map keys and
+// elements combined into it. newHash must return a new, empty hash each time
+// it is called.
+func WithHash64(newHash func() hash.Hash64) Option {
+	return func(c *config) {
+		c.hash64 = newHash
+	}
+}
+
+// WithSeed keys every hash with seed, including the hashes of individual map
+// keys and elements combined into the hash returned, so that Hashers with
+// different seeds produce unrelated hashes. Unlike WithInitBytes, which only
+// prefixes the value as a whole, the seed affects how map keys are ordered
+// and how sorted slices are compared.
+func WithSeed(seed uint64) Option {
+	return func(c *config) {
+		c.seed = make([]byte, 8)
+		binary.BigEndian.PutUint64(c.seed, seed)
+	}
+}
+
+// WithTypeIdentity writes the type of every scalar leaf, such as a number,
+// string or bool, along with its value, so that values of named types are
+// distinguished from values of their underlying type: with this option,
+// Flags(3) and uint32(3), or time.Duration(5) and int64(5), hash
+// differently, as do int(3) and int8(3) held in interfaces. Named slices,
+// arrays, maps and structs are still traversed by their contents alone; see
+// WithSchemaFingerprint to distinguish the type of the value as a whole.
+func WithTypeIdentity() Option {
+	return func(c *config) {
+		c.typeIdentity = true
+	}
+}
+
+// WithStableFloat hashes and compares floats as fixed-point numbers with
+// scale decimal places: each float is multiplied by 10^scale and rounded to
+// the nearest int64, so that, for instance, 0.1+0.2 and 0.3 hash equal with
+// a scale of 2. A negative scale rounds to tens, hundreds and so on. Floats
+// that differ only beyond the scale hash equal and aren't reported by Diff.
+// NaNs, infinities and floats too large to be scaled are hashed as usual.
+func WithStableFloat(scale int) Option {
+	return func(c *config) {
+		c.floatScale = math.Pow10(scale)
+	}
+}
+
+// WithSkipTypes skips values of any of types wherever they appear, as if
+// they weren't there, for instance to ignore every time.Time in a graph.
+// Values are matched by their exact type, checked both before and after
+// dereferencing pointers and interfaces, so skipping a type T skips values
+// of type T reached through a *T or an interface{}, as well as nil *T
+// pointers, while skipping *T only skips pointers. Skipped values aren't
+// reported by Diff.
+func WithSkipTypes(types ...reflect.Type) Option {
+	return func(c *config) {
+		if c.skipTypes == nil {
+			c.skipTypes = make(map[reflect.Type]struct{}, len(types))
+		}
+		for _, t := range types {
+			c.skipTypes[t] = struct{}{}
+		}
+	}
+}
+
+// WithTimeInstants hashes each time.Time as the instant it represents,
+// ignoring its location and monotonic clock reading, so that time.Now() and
+// time.Now().UTC() taken at the same instant hash equal and Diff doesn't
+// report them as different. A differing time.Time is reported once at its
+// path rather than by its internal fields.
+func WithTimeInstants() Option {
+	return func(c *config) {
+		c.timeInstants = true
+	}
+}
+
+// WithDurationAsString hashes each time.Duration as the string returned by
+// its String method, such as "1h30m0s", rather than as its nanoseconds, so
+// that Canonical output is human readable. Equal durations still hash
+// equal, but a time.Duration no longer hashes like the int64 holding the
+// same nanoseconds.
+func WithDurationAsString() Option {
+	return func(c *config) {
+		c.durationStrings = true
+	}
+}
+
+// WithMaxFields returns an error wrapping ErrTooManyFields once a traversal
+// writes more than n leaves, counting map keys and the leaves of map keys
+// and elements hashed on their own. It bounds the work done hashing
+// untrusted values, such as huge maps or slices. Diff applies the limit to
+// each side separately.
+func WithMaxFields(n int) Option {
+	return func(c *config) {
+		c.maxFields = n
+	}
+}
+
+// WithTypeChanges makes Diff report an interface holding values of
+// different dynamic types on each side as a single difference, such as
+// "value.I: type changed (testStruct vs int)", rather than reporting every
+// differing leaf below it. It doesn't affect hashes.
+func WithTypeChanges() Option {
+	return func(c *config) {
+		c.typeChanges = true
+	}
+}
+
+// WithGobCanonical hashes the gob encoding of each value rather than
+// traversing it, for interoperability with systems fingerprinting gob
+// encoded values. Every other option affecting how values are traversed is
+// ignored, though the seed, init bytes, version prefix and schema
+// fingerprint are still written first. It applies to Hash, Update and
+// Canonical but doesn't affect Diff.
+//
+// A gob stream identifies types by IDs depending on the order in which a
+// process first encodes them, so only the encoding of the value itself is
+// hashed, preceded by the name of its type rather than its ID. The hash
+// inherits the limits of gob: fields holding zero values are omitted and
+// pointers are followed, so for instance a nil *int field hashes like a
+// pointer to 0, and unexported, chan and func fields are ignored. gob encodes
+// maps in iteration order, so Hash returns an error for values whose type
+// contains a map, or an interface which may hold one, unless the type
+// encodes itself via GobEncode or MarshalBinary.
+func WithGobCanonical() Option {
+	return func(c *config) {
+		c.gobCanonical = true
+	}
+}
+
+// WithRecoverPanics returns an error wrapping ErrPanicked, including the
+// path of the value being traversed, rather than panicking when traversing
+// a value panics, for instance in a String method used by
+// WithStringerFallback or in a function passed to another option. It is a
+// safety net when hashing or comparing untrusted values. Paths are tracked
+// while hashing so that they can be reported, which makes hashing maps
+// slower.
+func WithRecoverPanics() Option {
+	return func(c *config) {
+		c.recoverPanics = true
+	}
+}
+
+// WithElementLimitPerContainer makes Diff and DiffTo report the
+// differences of at most n differing elements of each slice, array or map,
+// followed by a summary of the differences left out of each container, such
+// as "value.Items: 4823 more differences", so that comparing huge values
+// with many differences yields a bounded output. Summaries are written once
+// every difference has been found. Differences are still all counted by
+// DiffCount and DiffStats, and DiffPaths leaves the summaries out.
+func WithElementLimitPerContainer(n int) Option {
+	return func(c *config) {
+		c.elementLimit = n
+	}
+}
+
+// WithDistinctEmpty writes a leaf for each empty slice, array or map, which
+// otherwise contribute nothing, so that distinct empty values don't all hash
+// to the hash of no bytes at all: []int{}, [0]int{} and map[string]int{}
+// hash differently from each other and from "". Empty structs already write
+// their type. With WithTypeIdentity, the leaf holds the type of the empty
+// value, so []int{} and []string{} also hash differently. Nil and empty
+// slices or maps still hash equal. It doesn't affect Diff.
+func WithDistinctEmpty() Option {
+	return func(c *config) {
+		c.distinctEmpty = true
+	}
+}
+
+// WithMemoizeShared remembers the bytes written for each value reached
+// through a pointer during a single Hash and writes them again when the
+// same pointer is reached again, rather than traversing the value again.
+// This speeds up hashing values sharing many subtrees, such as directed
+// acyclic graphs, whose shared nodes are otherwise traversed once per path
+// leading to them. Hashes are unchanged, so shared and copied values still
+// hash equal. Values below a cycle are traversed again. It is ignored with
+// WithMaxDepth, WithMaxDepthError, WithMaxFields and WithStructureSensitive,
+// and whenever paths are tracked, as by Diff, HashPartial and
+// WithRecoverPanics.
+func WithMemoizeShared() Option {
+	return func(c *config) {
+		c.memoizeShared = true
+	}
+}
+
+// Hasher hashes and compares values according to its options. A Hasher is
+// safe for concurrent use except for Update and Sum64, which maintain a
+// running hash.
+type Hasher struct {
+	cfg     config
+	running hash.Hash64
+	// concrete is set when h has no options, so that values of common
+	// concrete types can be hashed without reflection
+	concrete bool
+}
+
+// New returns a Hasher configured with the given options
+func New(opts ...Option) *Hasher {
+	h := &Hasher{}
+	for _, opt := range opts {
+		opt(&h.cfg)
+	}
+	h.cfg.handlers = &sync.Map{}
+	h.cfg.plans = &sync.Map{}
+	h.concrete = len(opts) == 0
+	return h
+}
+
+// Hash returns a hash of src, fnv64a unless configured with WithHash64,
+// hashing recursively any exported properties, including slices and maps.
+// As funcs are hashed by address, values holding a non-nil func shouldn't
+// be hashed for storage: their hash changes when the program is rebuilt.
+func (h *Hasher) Hash(src interface{}) (uint64, error) {
+	if h.concrete {
+		if v, ok := hashConcrete(h.cfg.newHash, src); ok {
+			return v, nil
+		}
+	}
+	return h.hash(h.cfg.initBytes, src)
+}
+
+// HashObjects returns a hash of srcs that doesn't depend on their order,
+// for instance to hash an unordered batch of records. Each of srcs is hashed
+// on its own, as by Hash, and the resulting hashes are hashed in sorted
+// order. Duplicates are retained, so hashing a record twice differs from
+// hashing it once.
+func (h *Hasher) HashObjects(srcs ...interface{}) (uint64, error) {
+	hashes := make([]uint64, len(srcs))
+	for i, src := range srcs {
+		sh, err := h.Hash(src)
+		if err != nil {
+			return 0, err
+		}
+		hashes[i] = sh
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i] < hashes[j]
+	})
+
+	fh := h.cfg.newHash()
+	err := h.cfg.writeHeader(fh, h.cfg.initBytes)
+	if err != nil {
+		return 0, err
+	}
+	p := make([]byte, 8)
+	for _, sh := range hashes {
+		binary.BigEndian.PutUint64(p, sh)
+		_, err = fh.Write(p)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return fh.Sum64(), nil
+}
+
+// hash returns the hash of src, writing prefix before traversing src
+func (h *Hasher) hash(prefix []byte, src interface{}) (uint64, error) {
+	fh := h.cfg.newHash()
+	err := h.cfg.writeHeader(fh, prefix)
+	if err != nil {
+		return 0, err
+	}
+	err = h.cfg.writeSchema(fh, reflect.TypeOf(src))
+	if err != nil {
+		return 0, err
+	}
+	err = h.writeValue(fh, src)
+	if err != nil {
+		return 0, err
+	}
+	return fh.Sum64(), nil
+}
+
+// Update traverses src into the running hash of h without resetting it,
+// allowing values to be hashed one at a time as they become available. The
+// running hash is order sensitive: Update(a) followed by Update(b) differs
+// from Update(b) followed by Update(a).
+func (h *Hasher) Update(src interface{}) error {
+	h.startRunning()
+	err := h.cfg.writeSchema(h.running, reflect.TypeOf(src))
+	if err != nil {
+		return err
+	}
+	return h.writeValue(h.running, src)
+}
+
+// Sum64 returns the current value of the running hash fed by Update
+func (h *Hasher) Sum64() uint64 {
+	h.startRunning()
+	return h.running.Sum64()
+}
+
+// startRunning creates the running hash if it doesn't exist yet
+func (h *Hasher) startRunning() {
+	if h.running != nil {
+		return
+	}
+	h.running = h.cfg.newHash()
+	// Writing to a hash never fails
+	_ = h.cfg.writeHeader(h.running, h.cfg.initBytes)
+}
+
+// Diff returns a list of differences between lSrc and rSrc
+func (h *Hasher) Diff(field string, lSrc, rSrc interface{}) ([]string, error) {
+	cw := newCompareWriter()
+	err := h.compare(field, lSrc, rSrc, cw)
+	if err != nil {
+		return nil, err
+	}
+	return cw.diffs, nil
+}
+
+// DiffPaths returns the paths of the differences between lSrc and rSrc.
+// The paths are those reported by Diff, without the description of each
+// difference, so "value.S is not equal" and "value[k] added" are returned as
+// "value.S" and "value[k]".
+func (h *Hasher) DiffPaths(field string, lSrc, rSrc interface{}) ([]string, error) {
+	cw := newCompareWriter()
+	cw.pathsOnly = true
+	err := h.compare(field, lSrc, rSrc, cw)
+	if err != nil {
+		return nil, err
+	}
+	return cw.diffs, nil
+}
+
+// DiffTo writes each difference between lSrc and rSrc to out as a line as
+// soon as it is found. The lines match the differences returned by Diff,
+// though differences found while traversing rSrc are written first, followed
+// by fields and map keys only present in lSrc. Writing stops at the first
+// error writing to out, which is returned once the comparison completes.
+func (h *Hasher) DiffTo(out io.Writer, field string, lSrc, rSrc interface{}) error {
+	cw := newCompareWriter()
+	cw.out = out
+	err := h.compare(field, lSrc, rSrc, cw)
+	if err != nil {
+		return err
+	}
+	return cw.err
+}
+
+// DiffCount returns the number of differences between lSrc and rSrc. It is
+// consistent with len(Diff("", lSrc, rSrc)) but doesn't build the list of
+// differences.
+func (h *Hasher) DiffCount(lSrc, rSrc interface{}) (int, error) {
+	cw := newCompareWriter()
+	cw.countOnly = true
+	err := h.compare("", lSrc, rSrc, cw)
+	if err != nil {
+		return 0, err
+	}
+	return cw.count, nil
+}
+
+// DiffEqual returns true if there are no differences between lSrc and
+// rSrc. It is consistent with len(Diff("", lSrc, rSrc)) == 0 but stops
+// traversing rSrc as soon as a difference is found.
+func (h *Hasher) DiffEqual(lSrc, rSrc interface{}) (bool, error) {
+	cw := newCompareWriter()
+	cw.countOnly = true
+	cw.stopEarly = true
+	err := h.compare("", lSrc, rSrc, cw)
+	if errors.Is(err, errDifferent) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return cw.count == 0, nil
+}
+
+// DiffStats returns the number of differences between lSrc and rSrc by the
+// kind of the differing leaf, for instance to report that three strings and
+// one int differ. Nil values are counted as reflect.Invalid, keys present on
+// only one side as reflect.Map and differing structs with no hashable
+// fields as reflect.Struct. When the two sides of a difference have
+// different kinds, the kind of rSrc is counted.
+func (h *Hasher) DiffStats(lSrc, rSrc interface{}) (map[reflect.Kind]int, error) {
+	cw := newCompareWriter()
+	cw.countOnly = true
+	cw.stats = make(map[reflect.Kind]int)
+	err := h.compare("", lSrc, rSrc, cw)
+	if err != nil {
+		return nil, err
+	}
+	return cw.stats, nil
+}
+
+// compare traverses lSrc then rSrc, recording their differences to cw
+func (h *Hasher) compare(field string, lSrc, rSrc interface{}, cw *compareWriter) error {
+	if field == "" {
+		field = "value"
+	}
+	if h.cfg.elementLimit > 0 && !cw.countOnly {
+		cw.limit = h.cfg.elementLimit
+		cw.elements = make(map[string]string)
+		cw.shown = make(map[string]map[string]struct{})
+		cw.hidden = make(map[string]int)
+	}
+
+	return h.compareValues(field, reflect.ValueOf(lSrc), reflect.ValueOf(rSrc), cw)
+}
+
+// compareValues traverses lSrc then rSrc, recording their differences to cw
+func (h *Hasher) compareValues(field string, lSrc, rSrc reflect.Value, cw *compareWriter) error {
+	err := h.traverse(lSrc, field, cw)
+	if err != nil {
+		return err
+	}
+
+	cw.comparing = true
+	err = h.traverse(rSrc, field, cw)
+	if err != nil {
+		return err
+	}
+
+	cw.finish()
+
+	return nil
+}
+
+// traverse traverses src writing each field to fw
+func (h *Hasher) traverse(src reflect.Value, field string, fw fieldWriter) (err error) {
+	w := h.walker(fw)
+	defer w.release()
+	if h.cfg.recoverPanics {
+		if field == "" {
+			// Names the root so a panic can be located
+			field = "value"
+		}
+		defer w.recoverPanic(&err)
+	}
+	if field != "" {
+		w.named = true
+		w.name = append(w.name, field...)
+	}
+	return w.deepHash(src)
+}
+
+// recoverPanic, when deferred by a traversal with w, recovers from a panic
+// and sets err to an error wrapping ErrPanicked naming the path reached
+func (w *walker) recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w at %s: %v", ErrPanicked, w.field(), r)
+	}
+}
+
+// walker returns a new walker for a single traversal writing to fw. The
+// walker should be released once the traversal completes.
+func (h *Hasher) walker(fw fieldWriter) *walker {
+	w := &walker{
+		cfg:     &h.cfg,
+		h:       fw,
+		visited: visitedPool.Get().(map[uintptr][]visitKey),
+	}
+	if h.cfg.maxFields > 0 {
+		w.fields = new(int)
+	}
+	if cw, ok := fw.(*compareWriter); ok {
+		w.cw = cw
+		w.segments = cw.segments
+	} else if h.cfg.memoizeShared && h.cfg.maxDepth == 0 && h.cfg.maxFields == 0 && !h.cfg.structureSensitive {
+		w.memo = make(map[pointer]memoEntry)
+		w.mw = &memoWriter{w: fw}
+		w.h = w.mw
+		w.cuts = new(int)
+	}
+	return w
+}
@@ -0,0 +1,2016 @@
+package deephash_test
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"moqueries.org/deephash"
+)
+
+func TestWithKindTags(t *testing.T) {
+	f := 43.0
+	i := int64(math.Float64bits(f))
+
+	if deephash.Hash(i) != deephash.Hash(f) {
+		t.Fatalf("expected an int64 and a float64 with the same bits to collide without kind tags")
+	}
+
+	h := deephash.New(deephash.WithKindTags())
+	ih, err := h.Hash(i)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	fh, err := h.Hash(f)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if ih == fh {
+		t.Errorf("got %d == %d, want different hashes with kind tags", ih, fh)
+	}
+
+	sh, err := h.Hash(string([]byte{0x40, 0x45, 0x80, 0, 0, 0, 0, 0}))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if sh == fh || sh == ih {
+		t.Errorf("got %d, want a string hash different to %d and %d", sh, fh, ih)
+	}
+}
+
+func TestWithSortedSlices(t *testing.T) {
+	h := deephash.New(deephash.WithSortedSlices())
+
+	permutations := [][]string{
+		{"a", "b", "b", "c"},
+		{"b", "a", "c", "b"},
+		{"c", "b", "b", "a"},
+		{"b", "c", "a", "b"},
+	}
+	first := mustHash(t, h, permutations[0])
+	for _, p := range permutations[1:] {
+		if got := mustHash(t, h, p); got != first {
+			t.Errorf("got %d for %#v, want %d", got, p, first)
+		}
+	}
+
+	if mustHash(t, h, []string{"a", "b", "c"}) == first {
+		t.Errorf("want duplicates to affect the hash")
+	}
+	if mustHash(t, h, []string{"a", "b", "c", "c"}) == first {
+		t.Errorf("want differing duplicates to affect the hash")
+	}
+
+	s := []int{3, 1, 2}
+	if mustHash(t, h, s) != mustHash(t, h, [3]int{2, 3, 1}) {
+		t.Errorf("want permuted slices and arrays to hash equal")
+	}
+	if !reflect.DeepEqual(s, []int{3, 1, 2}) {
+		t.Errorf("got %#v, want the slice to be unmodified", s)
+	}
+
+	if deephash.Hash([]int{1, 2}) == deephash.Hash([]int{2, 1}) {
+		t.Errorf("want order to matter without the option")
+	}
+}
+
+type node struct {
+	Val  string
+	L, R *node
+}
+
+func TestWithStructureSensitive(t *testing.T) {
+	c1 := &node{Val: "child"}
+	c2 := &node{Val: "child"}
+	shared := node{L: c1, R: c1}
+	copied := node{L: c1, R: c2}
+
+	if deephash.Hash(shared) != deephash.Hash(copied) {
+		t.Fatalf("want shared and copied children to hash equal by default")
+	}
+
+	h := deephash.New(deephash.WithStructureSensitive())
+	sh, err := h.Hash(shared)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	ch, err := h.Hash(copied)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if sh == ch {
+		t.Errorf("got %d == %d, want shared and copied children to hash differently", sh, ch)
+	}
+
+	sh2, err := h.Hash(node{L: c2, R: c2})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if sh != sh2 {
+		t.Errorf("got %d != %d, want graphs with the same shape to hash equal", sh, sh2)
+	}
+
+	diffs, err := h.Diff("xyz", shared, copied)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) == 0 {
+		t.Errorf("want differences between shared and copied children")
+	}
+
+	cyclic := &node{Val: "a"}
+	cyclic.L = cyclic
+	if _, err := h.Hash(cyclic); err != nil {
+		t.Errorf("got %#v, want no error", err)
+	}
+}
+
+func TestWithStructureSensitiveSlices(t *testing.T) {
+	type child struct {
+		Name string
+	}
+	type parent struct {
+		Children []*child
+	}
+	a, b := &child{Name: "a"}, &child{Name: "a"}
+	shared := parent{Children: []*child{a, a, b}}
+	copied := parent{Children: []*child{{Name: "a"}, {Name: "a"}, {Name: "a"}}}
+	moved := parent{Children: []*child{a, b, b}}
+
+	for _, p := range []parent{copied, moved} {
+		if deephash.Hash(shared) != deephash.Hash(p) {
+			t.Errorf("want shared and distinct elements to hash equal by default")
+		}
+		if diffs := deephash.Diff("xyz", shared, p); len(diffs) != 0 {
+			t.Errorf("got %#v, want no differences by default", diffs)
+		}
+	}
+
+	h := deephash.New(deephash.WithStructureSensitive())
+	if mustHash(t, h, shared) == mustHash(t, h, copied) {
+		t.Errorf("want shared and copied elements to hash differently")
+	}
+	if mustHash(t, h, shared) == mustHash(t, h, moved) {
+		t.Errorf("want elements shared at different indexes to hash differently")
+	}
+	c, d := &child{Name: "a"}, &child{Name: "a"}
+	if mustHash(t, h, shared) != mustHash(t, h, parent{Children: []*child{c, c, d}}) {
+		t.Errorf("want slices sharing elements at the same indexes to hash equal")
+	}
+
+	diffs, err := h.Diff("xyz", shared, copied)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	var found bool
+	for _, d := range diffs {
+		found = found || strings.HasPrefix(d, "xyz.Children[1]")
+	}
+	if !found {
+		t.Errorf("got %#v, want the shared element to differ", diffs)
+	}
+}
+
+func TestWithTypeNames(t *testing.T) {
+	h := deephash.New(deephash.WithTypeNames())
+
+	diffs, err := h.Diff("xyz",
+		testStruct{Interface: testStruct{I: 42}},
+		testStruct{Interface: testStruct{I: 43}})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz.Interface(testStruct).I is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	diffs, err = h.Diff("xyz",
+		testStruct{Interface: &testStruct{S: "a"}},
+		testStruct{Interface: 42})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	var sawPtr, sawInt bool
+	for _, d := range diffs {
+		if strings.HasPrefix(d, "xyz.Interface(*deephash_test.testStruct).") {
+			sawPtr = true
+		}
+		if d == "xyz.Interface(int) is not equal" {
+			sawInt = true
+		}
+	}
+	if !sawPtr || !sawInt {
+		t.Errorf("got %#v, want paths annotated with both dynamic types", diffs)
+	}
+
+	l, err := h.Hash(testStruct{Interface: 42})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if l != deephash.Hash(testStruct{Interface: 42}) {
+		t.Errorf("want type names not to affect the hash")
+	}
+}
+
+func TestWithMapKeyOrder(t *testing.T) {
+	t.Run("ints", func(t *testing.T) {
+		h := deephash.New(deephash.WithMapKeyOrder(func(a, b reflect.Value) bool {
+			return a.Int() < b.Int()
+		}))
+
+		l := map[int]string{}
+		r := map[int]string{}
+		var expected []string
+		for i := 0; i < 20; i++ {
+			l[i] = "l"
+			r[i] = "r"
+			expected = append(expected, fmt.Sprintf("xyz[%d] is not equal", i))
+		}
+
+		diffs, err := h.Diff("xyz", l, r)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if !reflect.DeepEqual(diffs, expected) {
+			t.Errorf("got %#v, want %#v", diffs, expected)
+		}
+	})
+
+	t.Run("strings", func(t *testing.T) {
+		h := deephash.New(deephash.WithMapKeyOrder(func(a, b reflect.Value) bool {
+			return a.String() < b.String()
+		}))
+
+		l := map[string]int{"c": 1, "a": 1, "d": 1, "b": 1}
+		r := map[string]int{"b": 2, "d": 2, "a": 2, "c": 2}
+		diffs, err := h.Diff("xyz", l, r)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		expected := []string{
+			"xyz[a] is not equal",
+			"xyz[b] is not equal",
+			"xyz[c] is not equal",
+			"xyz[d] is not equal",
+		}
+		if !reflect.DeepEqual(diffs, expected) {
+			t.Errorf("got %#v, want %#v", diffs, expected)
+		}
+
+		lh, err := h.Hash(l)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		lh2, err := h.Hash(map[string]int{"a": 1, "b": 1, "c": 1, "d": 1})
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if lh != lh2 {
+			t.Errorf("got %d != %d, want equal maps to hash equal", lh, lh2)
+		}
+	})
+}
+
+func TestWithNumericCanonical(t *testing.T) {
+	h := deephash.New(deephash.WithNumericCanonical())
+
+	expected := mustHash(t, h, 42)
+	for _, v := range []interface{}{uint(42), float64(42), int8(42), uint64(42), float32(42)} {
+		if got := mustHash(t, h, v); got != expected {
+			t.Errorf("got %d for %#v, want %d", got, v, expected)
+		}
+	}
+	if mustHash(t, h, 42.5) == expected {
+		t.Errorf("want different numbers to hash differently")
+	}
+	if mustHash(t, h, math.Copysign(0, -1)) != mustHash(t, h, 0) {
+		t.Errorf("want negative zero to hash as zero")
+	}
+
+	l := map[string]interface{}{"a": 1, "b": []interface{}{2, 3.5}}
+	r := map[string]interface{}{"a": 1.0, "b": []interface{}{uint(2), float32(3.5)}}
+	if mustHash(t, h, l) != mustHash(t, h, r) {
+		t.Errorf("want loosely typed structures to hash equal")
+	}
+	diffs, err := h.Diff("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+
+	if deephash.Hash(42) == deephash.Hash(float64(42)) {
+		t.Errorf("want numeric kinds to hash differently without the option")
+	}
+}
+
+func TestWithStringNormalization(t *testing.T) {
+	const (
+		nfc = "caf\u00e9"
+		nfd = "cafe\u0301"
+	)
+	// A tiny stand-in for norm.NFC.String covering the test strings
+	toNFC := func(s string) string {
+		return strings.ReplaceAll(s, "e\u0301", "\u00e9")
+	}
+
+	if deephash.Hash(nfc) == deephash.Hash(nfd) {
+		t.Fatalf("want NFC and NFD forms to hash differently without the option")
+	}
+
+	h := deephash.New(deephash.WithStringNormalization(toNFC))
+
+	if mustHash(t, h, nfc) != mustHash(t, h, nfd) {
+		t.Errorf("want NFC and NFD forms to hash equal")
+	}
+	if mustHash(t, h, testStruct{S: nfc}) != mustHash(t, h, &testStruct{S: nfd}) {
+		t.Errorf("want NFC and NFD struct fields to hash equal")
+	}
+	if mustHash(t, h, map[string]int{nfc: 1}) != mustHash(t, h, map[string]int{nfd: 1}) {
+		t.Errorf("want NFC and NFD map keys to hash equal")
+	}
+	diffs, err := h.Diff("xyz", map[string]string{nfc: nfd}, map[string]string{nfd: nfc})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+	if mustHash(t, h, nfc) == mustHash(t, h, "cafe") {
+		t.Errorf("want different strings to hash differently")
+	}
+}
+
+func TestWithRuneStringEquivalence(t *testing.T) {
+	h := deephash.New(deephash.WithRuneStringEquivalence())
+
+	expected := mustHash(t, h, "abc")
+	if got := mustHash(t, h, []rune("abc")); got != expected {
+		t.Errorf("got %d, want []rune to hash like a string %d", got, expected)
+	}
+	if got := mustHash(t, h, []byte("abc")); got != expected {
+		t.Errorf("got %d, want []byte to hash like a string %d", got, expected)
+	}
+	if got := mustHash(t, h, []rune("héllo")); got != mustHash(t, h, "héllo") {
+		t.Errorf("got %d, want multi-byte runes to hash like a string", got)
+	}
+	if mustHash(t, h, []rune("abd")) == expected {
+		t.Errorf("want different runes to hash differently")
+	}
+	if deephash.Hash([]rune("abc")) == deephash.Hash("abc") {
+		t.Errorf("want []rune and string to hash differently without the option")
+	}
+
+	type runes struct {
+		r []rune
+	}
+	type str struct {
+		s string
+	}
+	type bytes struct {
+		b []byte
+	}
+	if mustHash(t, h, runes{r: []rune("abc")}) != mustHash(t, h, str{s: "abc"}) {
+		t.Errorf("want unexported []rune fields to hash like strings")
+	}
+	if mustHash(t, h, bytes{b: []byte("abc")}) != mustHash(t, h, str{s: "abc"}) {
+		t.Errorf("want unexported []byte fields to hash like strings")
+	}
+}
+
+func TestWithByteSliceAsString(t *testing.T) {
+	for _, opts := range [][]deephash.Option{
+		{deephash.WithByteSliceAsString()},
+		{deephash.WithByteSliceAsString(), deephash.WithKindTags()},
+		{deephash.WithByteSliceAsString(), deephash.WithStringNormalization(strings.ToLower)},
+	} {
+		h := deephash.New(opts...)
+
+		expected := mustHash(t, h, "abc")
+		if got := mustHash(t, h, []byte("abc")); got != expected {
+			t.Errorf("got %d, want []byte to hash like a string %d", got, expected)
+		}
+		if mustHash(t, h, []byte("abd")) == expected {
+			t.Errorf("want different bytes to hash differently")
+		}
+		if got := mustHash(t, h, []byte{0xff, 0x00}); got != mustHash(t, h, "\xff\x00") {
+			t.Errorf("got %d, want binary data to hash like a string with the same bytes", got)
+		}
+		type str struct {
+			s string
+		}
+		type bytes struct {
+			b []byte
+		}
+		if mustHash(t, h, bytes{b: []byte("abc")}) != mustHash(t, h, str{s: "abc"}) {
+			t.Errorf("want unexported []byte fields to hash like strings")
+		}
+	}
+
+	h := deephash.New(deephash.WithByteSliceAsString())
+	diffs, err := h.Diff("xyz", []byte("abc"), []byte("abd"))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 1 || diffs[0] != "xyz is not equal" {
+		t.Errorf("got %v, want a single difference at the root", diffs)
+	}
+}
+
+func TestHasherUpdate(t *testing.T) {
+	a := testStruct{S: "a", I: 1}
+	b := map[string]int{"b": 2}
+
+	h := deephash.New()
+	empty := h.Sum64()
+	if err := h.Update(a); err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	first := h.Sum64()
+	if first == empty {
+		t.Errorf("want Update to change the running hash")
+	}
+	if first != deephash.Hash(a) {
+		t.Errorf("got %d, want a single Update to match Hash %d", first, deephash.Hash(a))
+	}
+	if err := h.Update(b); err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if got, want := h.Sum64(), deephash.Hash([]interface{}{a, b}); got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+
+	reversed := deephash.New()
+	if err := reversed.Update(b); err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if err := reversed.Update(a); err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if reversed.Sum64() == h.Sum64() {
+		t.Errorf("want the running hash to be order sensitive")
+	}
+
+	if got, err := h.Hash(a); err != nil || got != first {
+		t.Errorf("got %d, %#v, want Hash to be unaffected by the running hash", got, err)
+	}
+}
+
+type withOptional struct {
+	A int
+	B *int
+	C interface{}
+}
+
+type withoutOptional struct {
+	A int
+}
+
+func TestWithSkipNilPointers(t *testing.T) {
+	if deephash.Hash(withOptional{A: 1}) == deephash.Hash(withoutOptional{A: 1}) {
+		t.Fatalf("want nil fields to affect the hash without the option")
+	}
+
+	h := deephash.New(deephash.WithSkipNilPointers())
+
+	if mustHash(t, h, withOptional{A: 1}) != mustHash(t, h, withoutOptional{A: 1}) {
+		t.Errorf("want unset optional fields not to affect the hash")
+	}
+	b := 2
+	if mustHash(t, h, withOptional{A: 1, B: &b}) == mustHash(t, h, withoutOptional{A: 1}) {
+		t.Errorf("want set optional fields to affect the hash")
+	}
+
+	diffs, err := h.Diff("xyz", withOptional{A: 1}, withoutOptional{A: 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+
+	diffs, err = h.Diff("xyz", withOptional{A: 1}, withOptional{A: 1, B: &b})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz.B is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestWithByteFastPath(t *testing.T) {
+	var arr [1 << 20]byte
+	for i := range arr {
+		arr[i] = byte(i * 7)
+	}
+
+	h := deephash.New(deephash.WithByteFastPath())
+
+	single := fnv.New64a()
+	_, _ = single.Write(arr[:])
+	expected := single.Sum64()
+
+	if got := mustHash(t, h, arr); got != expected {
+		t.Errorf("got %d, want chunked array writes to match a single write %d", got, expected)
+	}
+	if got := mustHash(t, h, &arr); got != expected {
+		t.Errorf("got %d, want addressable array writes to match a single write %d", got, expected)
+	}
+	if got := mustHash(t, h, arr[:]); got != expected {
+		t.Errorf("got %d, want chunked slice writes to match a single write %d", got, expected)
+	}
+
+	other := arr
+	other[len(other)-1]++
+	if mustHash(t, h, other) == expected {
+		t.Errorf("want different bytes to hash differently")
+	}
+
+	diffs, err := h.Diff("xyz", []byte("abcd"), []byte("abed"))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	want := []string{"xyz is not equal"}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("got %#v, want %#v", diffs, want)
+	}
+
+	tagged := deephash.New(deephash.WithByteFastPath(), deephash.WithKindTags())
+	th, err := tagged.Hash(arr)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	sh, err := tagged.Hash(arr[:])
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if th != sh {
+		t.Errorf("got %d != %d, want tagged arrays and slices to hash equal", th, sh)
+	}
+}
+
+func BenchmarkWithByteFastPath(b *testing.B) {
+	var arr [1 << 20]byte
+	for i := range arr {
+		arr[i] = byte(i)
+	}
+
+	for name, h := range map[string]*deephash.Hasher{
+		"default":        deephash.New(),
+		"byte fast path": deephash.New(deephash.WithByteFastPath()),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = h.Hash(arr)
+			}
+		})
+	}
+}
+
+func TestWithPrimitiveFastPath(t *testing.T) {
+	ints := make([]int, 20000)
+	for i := range ints {
+		ints[i] = i * 7919
+	}
+	floats := [5]float32{1.5, -0, float32(math.Inf(1)), float32(math.NaN()), 3}
+	type named int
+	type holder struct {
+		u []uint16
+		n [3]named
+	}
+	values := []interface{}{
+		ints,
+		&ints,
+		[]int8{-1, 0, 1},
+		floats,
+		&floats,
+		[]uint64{},
+		holder{u: []uint16{1, 2}, n: [3]named{4, 5, 6}},
+		[]time.Duration{time.Second, time.Minute},
+	}
+
+	for _, opts := range [][]deephash.Option{
+		nil,
+		{deephash.WithLengthPrefix()},
+		{deephash.WithKindTags()},
+		{deephash.WithContainerTags()},
+		{deephash.WithStringerFallback()},
+	} {
+		h := deephash.New(opts...)
+		fast := deephash.New(append(opts, deephash.WithPrimitiveFastPath())...)
+		for _, v := range values {
+			expected, err := h.Hash(v)
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			got, err := fast.Hash(v)
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			if got != expected {
+				t.Errorf("got %d, want the fast path to hash %T like elements on their own %d", got, v, expected)
+			}
+		}
+	}
+
+	limited := deephash.New(deephash.WithPrimitiveFastPath(), deephash.WithMaxFields(100))
+	if _, err := limited.Hash(ints); !errors.Is(err, deephash.ErrTooManyFields) {
+		t.Errorf("got %#v, want each element to count as a field", err)
+	}
+}
+
+func BenchmarkWithPrimitiveFastPath(b *testing.B) {
+	var arr [100000]int
+	for i := range arr {
+		arr[i] = i
+	}
+
+	for name, h := range map[string]*deephash.Hasher{
+		"default":             deephash.New(),
+		"primitive fast path": deephash.New(deephash.WithPrimitiveFastPath()),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = h.Hash(&arr)
+			}
+		})
+	}
+}
+
+// panicky panics when formatted
+type panicky struct{}
+
+func (panicky) String() string {
+	panic("boom")
+}
+
+func TestWithRecoverPanics(t *testing.T) {
+	type inner struct {
+		P panicky
+	}
+	type outer struct {
+		A int
+		I []inner
+	}
+	src := outer{A: 1, I: []inner{{}}}
+
+	h := deephash.New(deephash.WithStringerFallback(), deephash.WithRecoverPanics())
+	_, err := h.Hash(src)
+	if !errors.Is(err, deephash.ErrPanicked) {
+		t.Fatalf("got %#v, want an error wrapping ErrPanicked", err)
+	}
+	if expected := "panicked at value.I[0].P: boom"; err.Error() != expected {
+		t.Errorf("got %q, want %q", err.Error(), expected)
+	}
+
+	_, err = h.Diff("xyz", src, outer{})
+	if !errors.Is(err, deephash.ErrPanicked) {
+		t.Fatalf("got %#v, want an error wrapping ErrPanicked", err)
+	}
+	if expected := "panicked at xyz.I[0].P: boom"; err.Error() != expected {
+		t.Errorf("got %q, want %q", err.Error(), expected)
+	}
+
+	_, err = h.DiffSlicesLCS("xyz", src.I, []inner{})
+	if !errors.Is(err, deephash.ErrPanicked) {
+		t.Fatalf("got %#v, want an error wrapping ErrPanicked", err)
+	}
+	if expected := "panicked at xyz[0]: boom"; err.Error() != expected {
+		t.Errorf("got %q, want %q", err.Error(), expected)
+	}
+	_, err = h.DiffIgnoringOrder(src.I, []inner{})
+	if !errors.Is(err, deephash.ErrPanicked) {
+		t.Fatalf("got %#v, want an error wrapping ErrPanicked", err)
+	}
+
+	plain := deephash.New(deephash.WithRecoverPanics())
+	expected, err := deephash.HashE(src)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	got, err := plain.Hash(src)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if got != expected {
+		t.Errorf("got %d, want recovering panics not to change the hash %d", got, expected)
+	}
+}
+
+func TestWithElementLimitPerContainer(t *testing.T) {
+	l := make([]int, 5000)
+	r := make([]int, 5000)
+	for i := range r {
+		r[i] = i % 2
+	}
+	h := deephash.New(deephash.WithElementLimitPerContainer(3))
+
+	diffs, err := h.Diff("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{
+		"xyz[1] is not equal",
+		"xyz[3] is not equal",
+		"xyz[5] is not equal",
+		"xyz: 2497 more differences",
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	var buf bytes.Buffer
+	err = h.DiffTo(&buf, "xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if got := strings.Join(expected, "\n") + "\n"; buf.String() != got {
+		t.Errorf("got %q, want %q", buf.String(), got)
+	}
+
+	count, err := h.DiffCount(l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if count != 2500 {
+		t.Errorf("got %d, want every difference to be counted", count)
+	}
+
+	type row struct {
+		A, B int
+	}
+	lRows := [][]row{{{}, {}, {}}, {{}}, {{}}}
+	rRows := [][]row{{{A: 1, B: 1}, {A: 1}, {A: 1}}, {{A: 1}}, {{A: 1}}}
+	diffs, err = deephash.New(deephash.WithElementLimitPerContainer(2)).Diff("xyz", lRows, rRows)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected = []string{
+		"xyz[0][0].A is not equal",
+		"xyz[0][0].B is not equal",
+		"xyz[0][1].A is not equal",
+		"xyz[1][0].A is not equal",
+		"xyz: 1 more difference",
+		"xyz[0]: 1 more difference",
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestWithDistinctEmpty(t *testing.T) {
+	if deephash.Hash([]int{}) != deephash.Hash(map[string]int{}) {
+		t.Fatalf("expected empty slices and maps to collide without the option")
+	}
+
+	for _, opts := range [][]deephash.Option{
+		{deephash.WithDistinctEmpty()},
+		{deephash.WithDistinctEmpty(), deephash.WithTypeIdentity()},
+	} {
+		h := deephash.New(opts...)
+		empties := []interface{}{
+			struct{}{},
+			emptyA{},
+			[]int{},
+			[0]int{},
+			map[string]int{},
+			"",
+			nil,
+		}
+		seen := make(map[uint64]interface{})
+		for _, e := range empties {
+			v, err := h.Hash(e)
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			if v == 0 {
+				t.Errorf("got a zero hash for %#v", e)
+			}
+			if prev, ok := seen[v]; ok {
+				t.Errorf("got %d for both %#v and %#v, want distinct hashes", v, prev, e)
+			}
+			seen[v] = e
+		}
+
+		nilSlice, err := h.Hash([]int(nil))
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if empty, _ := h.Hash([]int{}); nilSlice != empty {
+			t.Errorf("got %d, want nil and empty slices to hash equal %d", nilSlice, empty)
+		}
+	}
+
+	h := deephash.New(deephash.WithDistinctEmpty(), deephash.WithTypeIdentity())
+	ints, err := h.Hash([]int{})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	strs, err := h.Hash([]string{})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if ints == strs {
+		t.Errorf("got %d, want empty slices of different types to hash differently with type identity", ints)
+	}
+}
+
+// diamond returns the top of a DAG of depth levels, where each node points
+// twice to the same node of the level below
+func diamond(depth int) *node {
+	n := &node{Val: "bottom"}
+	for i := 0; i < depth; i++ {
+		n = &node{Val: strconv.Itoa(i), L: n, R: n}
+	}
+	return n
+}
+
+// copyTree returns a deep copy of the DAG n with no shared nodes
+func copyTree(n *node) *node {
+	if n == nil {
+		return nil
+	}
+	return &node{Val: n.Val, L: copyTree(n.L), R: copyTree(n.R)}
+}
+
+func TestWithMemoizeShared(t *testing.T) {
+	shared := &node{Val: "shared"}
+	cyclic := &node{Val: "a", L: &node{Val: "b"}}
+	cyclic.L.L = cyclic
+	cyclic.R = cyclic.L
+	reentrant := &node{Val: "c", L: cyclic.L, R: cyclic}
+
+	values := map[string]interface{}{
+		"diamond":   diamond(10),
+		"copy":      copyTree(diamond(10)),
+		"siblings":  []*node{shared, shared, {L: shared}},
+		"cyclic":    cyclic,
+		"reentrant": reentrant,
+		"map":       map[string]*node{"a": shared, "b": shared},
+	}
+	for _, opts := range [][]deephash.Option{nil, {deephash.WithKindTags()}, {deephash.WithSortedSlices()}} {
+		h := deephash.New(opts...)
+		memo := deephash.New(append(opts, deephash.WithMemoizeShared())...)
+		for name, v := range values {
+			expected, err := h.Hash(v)
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			got, err := memo.Hash(v)
+			if err != nil {
+				t.Fatalf("got %#v, want no error", err)
+			}
+			if got != expected {
+				t.Errorf("%s: got %d, want memoizing to leave the hash unchanged %d", name, got, expected)
+			}
+		}
+	}
+
+	h := deephash.New(deephash.WithMemoizeShared())
+	d, err := h.Hash(diamond(10))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	c, err := h.Hash(copyTree(diamond(10)))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if d != c {
+		t.Errorf("got %d, want shared and copied values to hash equal %d", d, c)
+	}
+}
+
+func BenchmarkWithMemoizeShared(b *testing.B) {
+	top := diamond(16)
+	for name, h := range map[string]*deephash.Hasher{
+		"default":        deephash.New(),
+		"memoize shared": deephash.New(deephash.WithMemoizeShared()),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = h.Hash(top)
+			}
+		})
+	}
+}
+
+func TestWithContainerTags(t *testing.T) {
+	// A map key is written as its length followed by its bytes
+	m := map[string]int{"a": 1}
+	s := []interface{}{uint64(1), "a", 1}
+	if deephash.Hash(m) != deephash.Hash(s) {
+		t.Fatalf("expected the map and the slice to collide without container tags")
+	}
+
+	h := deephash.New(deephash.WithContainerTags())
+	mh, err := h.Hash(m)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	sh, err := h.Hash(s)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if mh == sh {
+		t.Errorf("got %d == %d, want the map and the slice to hash differently", mh, sh)
+	}
+
+	ah, err := h.Hash([3]interface{}{uint64(1), "a", 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if ah == sh {
+		t.Errorf("got %d == %d, want the array and the slice to hash differently", ah, sh)
+	}
+
+	m2h, err := h.Hash(map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if mh != m2h {
+		t.Errorf("got %d != %d, want equal maps to hash equal", mh, m2h)
+	}
+}
+
+func TestWithFieldNameMapper(t *testing.T) {
+	snake := func(goName string) string {
+		var b strings.Builder
+		for i, r := range goName {
+			if unicode.IsUpper(r) {
+				if i > 0 {
+					b.WriteByte('_')
+				}
+				r = unicode.ToLower(r)
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+
+	type inner struct {
+		FieldValue int
+	}
+	type outer struct {
+		UserName string
+		Inner    inner
+	}
+
+	h := deephash.New(deephash.WithFieldNameMapper(snake))
+	l := outer{UserName: "a", Inner: inner{FieldValue: 1}}
+	r := outer{UserName: "b", Inner: inner{FieldValue: 2}}
+	diffs, err := h.Diff("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	sort.Strings(diffs)
+	expected := []string{
+		"xyz.inner.field_value is not equal",
+		"xyz.user_name is not equal",
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	lh, err := h.Hash(l)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if lh != deephash.Hash(l) {
+		t.Errorf("want the field name mapper not to affect the hash")
+	}
+}
+
+func chain(depth int, val string) *node {
+	n := &node{Val: val}
+	for i := 0; i < depth; i++ {
+		n = &node{Val: "link", L: n}
+	}
+	return n
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	h := deephash.New(deephash.WithMaxDepth(5))
+
+	if mustHash(t, h, chain(10, "a")) != mustHash(t, h, chain(10, "b")) {
+		t.Errorf("want values differing below the maximum depth to hash equal")
+	}
+	if deephash.Hash(chain(10, "a")) == deephash.Hash(chain(10, "b")) {
+		t.Errorf("want values differing deep down to hash differently without the option")
+	}
+	if mustHash(t, h, chain(1, "a")) == mustHash(t, h, chain(1, "b")) {
+		t.Errorf("want values differing above the maximum depth to hash differently")
+	}
+
+	diffs, err := h.Diff("xyz", chain(10, "a"), chain(10, "b"))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+}
+
+func TestWithMaxDepthError(t *testing.T) {
+	h := deephash.New(deephash.WithMaxDepthError(3))
+
+	_, err := h.Hash(chain(10, "a"))
+	if !errors.Is(err, deephash.ErrMaxDepthExceeded) {
+		t.Fatalf("got %#v, want ErrMaxDepthExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "value.L.L.") {
+		t.Errorf("got %q, want the error to include the path", err.Error())
+	}
+
+	_, err = h.Diff("xyz", chain(10, "a"), chain(10, "b"))
+	if !errors.Is(err, deephash.ErrMaxDepthExceeded) {
+		t.Fatalf("got %#v, want ErrMaxDepthExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "xyz.L.L.") {
+		t.Errorf("got %q, want the error to include the path", err.Error())
+	}
+
+	if _, err := h.Hash(testStruct{S: "shallow"}); err != nil {
+		t.Errorf("got %#v, want no error", err)
+	}
+}
+
+func TestWithFloatFormatter(t *testing.T) {
+	h := deephash.New(deephash.WithFloatFormatter(nil))
+	for f, expected := range map[float64]string{
+		1.5:     "1.5",
+		-2:      "-2",
+		0.1:     "0.1",
+		1e21:    "1e+21",
+		1.0 / 3: "0.3333333333333333",
+	} {
+		b, err := h.Canonical(f)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if string(b) != expected {
+			t.Errorf("got %q, want %q", b, expected)
+		}
+	}
+
+	b, err := h.Canonical(struct{ F float32 }{F: 0.5})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if string(b) != "0.5" {
+		t.Errorf("got %q, want %q", b, "0.5")
+	}
+
+	fixed := deephash.New(deephash.WithFloatFormatter(func(f float64) []byte {
+		return strconv.AppendFloat(nil, f, 'f', 2, 64)
+	}))
+	b, err = fixed.Canonical(1.0 / 3)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if string(b) != "0.33" {
+		t.Errorf("got %q, want %q", b, "0.33")
+	}
+
+	fh, err := h.Hash(1.5)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if fh == deephash.Hash(1.5) {
+		t.Errorf("want the float formatter to change the hash")
+	}
+	if fh != deephash.Hash("1.5") {
+		t.Errorf("got %d, want the float to hash as its decimal form %d", fh, deephash.Hash("1.5"))
+	}
+}
+
+func TestWithVersionPrefix(t *testing.T) {
+	h := deephash.New(deephash.WithVersionPrefix(), deephash.WithInitBytes([]byte("ns:")))
+	b, err := h.Canonical("foo")
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := fmt.Sprintf("deephash:v%d\x00ns:foo", deephash.AlgorithmVersion)
+	if string(b) != expected {
+		t.Errorf("got %q, want %q", b, expected)
+	}
+
+	vh, err := h.Hash("foo")
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	fh := fnv.New64a()
+	_, _ = fh.Write([]byte(expected))
+	if vh != fh.Sum64() {
+		t.Errorf("got %d, want %d", vh, fh.Sum64())
+	}
+
+	err = h.Update("foo")
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if h.Sum64() != vh {
+		t.Errorf("got %d, want the running hash to include the version %d", h.Sum64(), vh)
+	}
+
+	plain, err := deephash.New(deephash.WithInitBytes([]byte("ns:"))).Hash("foo")
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if plain == vh {
+		t.Errorf("want the version prefix to change the hash")
+	}
+}
+
+type failingValuer struct{}
+
+func (failingValuer) Value() (driver.Value, error) {
+	return nil, errWriteFailed
+}
+
+// gobVersion encodes only its version numbers, not its cached rendering
+type gobVersion struct {
+	major, minor int
+	rendered     string
+}
+
+func (v gobVersion) GobEncode() ([]byte, error) {
+	if v.major < 0 {
+		return nil, errors.New("negative version")
+	}
+	return []byte{byte(v.major), byte(v.minor)}, nil
+}
+
+func TestWithGobEncoders(t *testing.T) {
+	h := deephash.New(deephash.WithGobEncoders())
+
+	expected := mustHash(t, h, gobVersion{major: 1, minor: 2})
+	if got := mustHash(t, h, gobVersion{major: 1, minor: 2, rendered: "v1.2"}); got != expected {
+		t.Errorf("got %d, want fields left out of the encoding to be ignored %d", got, expected)
+	}
+	if got := mustHash(t, h, &gobVersion{major: 1, minor: 2}); got != expected {
+		t.Errorf("got %d, want pointers to hash by the encoding %d", got, expected)
+	}
+	if got := mustHash(t, h, []byte{1, 2}); got != expected {
+		t.Errorf("got %d, want the encoding to hash like its bytes %d", got, expected)
+	}
+	if mustHash(t, h, gobVersion{major: 1, minor: 3}) == expected {
+		t.Errorf("want different encodings to hash differently")
+	}
+	if deephash.Hash(gobVersion{major: 1, minor: 2}) == deephash.Hash(gobVersion{major: 1, minor: 2, rendered: "v1.2"}) {
+		t.Errorf("want values to hash by their fields without the option")
+	}
+
+	_, err := h.Hash(gobVersion{major: -1})
+	if err == nil || err.Error() != "negative version" {
+		t.Errorf("got %#v, want the error returned by GobEncode", err)
+	}
+}
+
+func TestWithDriverValuers(t *testing.T) {
+	h := deephash.New(deephash.WithDriverValuers())
+
+	if mustHash(t, h, sql.NullString{}) != mustHash(t, h, sql.NullString{String: "unused"}) {
+		t.Errorf("want invalid null strings to hash equal")
+	}
+	if mustHash(t, h, sql.NullString{}) != mustHash(t, h, nil) {
+		t.Errorf("want invalid null strings to hash like nil")
+	}
+	if mustHash(t, h, sql.NullInt64{}) != mustHash(t, h, sql.NullInt64{Int64: 42}) {
+		t.Errorf("want invalid null ints to hash equal")
+	}
+	if mustHash(t, h, sql.NullString{String: "a", Valid: true}) != mustHash(t, h, "a") {
+		t.Errorf("want valid null strings to hash by their string")
+	}
+	if mustHash(t, h, sql.NullString{String: "a", Valid: true}) == mustHash(t, h, sql.NullString{String: "b", Valid: true}) {
+		t.Errorf("want different valid null strings to hash differently")
+	}
+	if mustHash(t, h, &sql.NullString{String: "a", Valid: true}) != mustHash(t, h, "a") {
+		t.Errorf("want pointers to valid null strings to hash by their string")
+	}
+	if deephash.Hash(sql.NullString{}) == deephash.Hash(sql.NullString{String: "unused"}) {
+		t.Errorf("want null strings to hash by their fields without the option")
+	}
+
+	type row struct {
+		Name sql.NullString
+	}
+	diffs, err := h.Diff("xyz", row{Name: sql.NullString{String: "unused"}}, row{})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+
+	_, err = h.Hash(failingValuer{})
+	if !errors.Is(err, errWriteFailed) {
+		t.Errorf("got %#v, want %#v", err, errWriteFailed)
+	}
+}
+
+func TestWithLengthPrefix(t *testing.T) {
+	h := deephash.New(deephash.WithLengthPrefix())
+
+	type pair struct {
+		A, B interface{}
+	}
+	collisions := []struct {
+		name string
+		a, b interface{}
+	}{
+		{
+			name: "slices",
+			a:    pair{A: []int{1, 2}, B: []int{}},
+			b:    pair{A: []int{1}, B: []int{2}},
+		},
+		{
+			name: "arrays",
+			a:    pair{A: [2]int{1, 2}, B: [0]int{}},
+			b:    pair{A: [1]int{1}, B: [1]int{2}},
+		},
+		{
+			name: "maps",
+			a:    pair{A: map[string]int{"a": 1, "b": 2}, B: map[string]int{}},
+			b:    pair{A: map[string]int{"a": 1}, B: map[string]int{"b": 2}},
+		},
+		{
+			name: "bytes",
+			a:    pair{A: []byte("ab"), B: []byte("")},
+			b:    pair{A: []byte("a"), B: []byte("b")},
+		},
+	}
+	for _, tc := range collisions {
+		t.Run(tc.name, func(t *testing.T) {
+			if deephash.Hash(tc.a) != deephash.Hash(tc.b) {
+				t.Fatalf("want the values to collide without the option")
+			}
+			if mustHash(t, h, tc.a) == mustHash(t, h, tc.b) {
+				t.Errorf("want the values to hash differently")
+			}
+			if mustHash(t, h, tc.a) != mustHash(t, h, tc.a) {
+				t.Errorf("want equal values to hash equal")
+			}
+		})
+	}
+
+	diffs, err := h.Diff("xyz", []int{1, 2, 3}, []int{1, 2})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz is not equal", "xyz[2] is not equal"}
+	sort.Strings(diffs)
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	diffs, err = h.Diff("xyz", map[string]int{"a": 1}, map[string]int{"a": 1, "b": 2})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected = []string{"xyz is not equal", "xyz[b] added"}
+	sort.Strings(diffs)
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	bh := deephash.New(deephash.WithLengthPrefix(), deephash.WithByteFastPath())
+	diffs, err = bh.Diff("xyz", []byte("abc"), []byte("ab"))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected = []string{"xyz is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	diffs, err = h.Diff("xyz", [2]int{1, 2}, [2]int{1, 2})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+}
+
+// status is an enum whose identity is its code. lookups is incidental
+// state that shouldn't affect its identity.
+type status struct {
+	code    int
+	lookups int
+}
+
+func (s status) String() string {
+	return [...]string{"pending", "done"}[s.code]
+}
+
+// label calls back into the hasher from String, hashing itself with the
+// default Hasher
+type label string
+
+func (l label) String() string {
+	return "label:" + strconv.FormatUint(deephash.MustHash(l), 16)
+}
+
+func TestWithStringerFallback(t *testing.T) {
+	h := deephash.New(deephash.WithStringerFallback())
+
+	a, b := status{code: 1}, status{code: 1, lookups: 7}
+	if mustHash(t, h, a) != mustHash(t, h, b) {
+		t.Errorf("want equal enum values to hash equal")
+	}
+	if mustHash(t, h, a) != mustHash(t, h, "done") {
+		t.Errorf("want enum values to hash as their string")
+	}
+	if mustHash(t, h, a) == mustHash(t, h, status{code: 0}) {
+		t.Errorf("want different enum values to hash differently")
+	}
+	if mustHash(t, h, &a) != mustHash(t, h, b) {
+		t.Errorf("want pointers to enum values to hash as their string")
+	}
+	if deephash.Hash(a) == deephash.Hash(b) {
+		t.Errorf("want enum values to hash by their fields without the option")
+	}
+	if mustHash(t, h, label("x")) != mustHash(t, h, label("x").String()) {
+		t.Errorf("want a Stringer calling back into the hasher to hash as its string")
+	}
+	if mustHash(t, h, label("x")) == mustHash(t, h, label("y")) {
+		t.Errorf("want different labels to hash differently")
+	}
+
+	diffs, err := h.Diff("xyz", struct{ S status }{S: a}, struct{ S status }{S: status{}})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz.S is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestWithSchemaFingerprint(t *testing.T) {
+	h := deephash.New(deephash.WithSchemaFingerprint())
+
+	// Both versions of record share the same name, as a struct type would
+	// before and after a field is added
+	var v1, v2 interface{}
+	{
+		type record struct {
+			Name string
+		}
+		v1 = record{Name: "a"}
+	}
+	{
+		type record struct {
+			Name string
+			Tags []string
+		}
+		v2 = record{Name: "a"}
+	}
+
+	if deephash.Hash(v1) != deephash.Hash(v2) {
+		t.Fatalf("want the records to hash equal without the option")
+	}
+	if mustHash(t, h, v1) == mustHash(t, h, v2) {
+		t.Errorf("want adding a field to change the hash")
+	}
+	if mustHash(t, h, v1) != mustHash(t, h, v1) {
+		t.Errorf("want the fingerprint to be stable")
+	}
+	if mustHash(t, h, &node{Val: "a"}) != mustHash(t, h, &node{Val: "a"}) {
+		t.Errorf("want recursive types to be fingerprinted")
+	}
+	if mustHash(t, h, []int{}) == mustHash(t, h, []string{}) {
+		t.Errorf("want different element types to hash differently")
+	}
+	if mustHash(t, h, map[string]int{}) == mustHash(t, h, map[int]int{}) {
+		t.Errorf("want different key types to hash differently")
+	}
+
+	// Named containers of both versions of a record, again sharing names
+	var c1, c2 []interface{}
+	{
+		type record struct {
+			Name string
+		}
+		type records []record
+		type keyed map[string]record
+		type fixed [1]record
+		type ref *record
+		type byRecord map[record]bool
+		c1 = []interface{}{records{}, keyed{}, fixed{}, ref(&record{}), byRecord{}}
+	}
+	{
+		type record struct {
+			Name string
+			Tags int
+		}
+		type records []record
+		type keyed map[string]record
+		type fixed [1]record
+		type ref *record
+		type byRecord map[record]bool
+		c2 = []interface{}{records{}, keyed{}, fixed{}, ref(&record{}), byRecord{}}
+	}
+	for n := range c1 {
+		if mustHash(t, h, c1[n]) == mustHash(t, h, c2[n]) {
+			t.Errorf("want adding a field to change the hash of %T", c1[n])
+		}
+	}
+	type tree map[string]tree
+	if mustHash(t, h, tree{"a": tree{}}) != mustHash(t, h, tree{"a": tree{}}) {
+		t.Errorf("want recursive named containers to be fingerprinted")
+	}
+
+	diffs, err := h.Diff("xyz", v1, v2)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want the fingerprint not to affect Diff", diffs)
+	}
+}
+
+func TestWithCompactJSON(t *testing.T) {
+	h := deephash.New(deephash.WithCompactJSON(), deephash.WithByteFastPath())
+
+	compact := json.RawMessage(`{"a":[1,2],"b":"x y"}`)
+	indented := json.RawMessage("{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": \"x y\"\n}\n")
+	if mustHash(t, h, compact) != mustHash(t, h, indented) {
+		t.Errorf("want equivalent JSON documents to hash equal")
+	}
+	type doc struct {
+		Body json.RawMessage
+	}
+	if mustHash(t, h, doc{Body: compact}) != mustHash(t, h, doc{Body: indented}) {
+		t.Errorf("want equivalent JSON fields to hash equal")
+	}
+	if deephash.Hash(compact) == deephash.Hash(indented) {
+		t.Errorf("want formatting to matter without the option")
+	}
+	if mustHash(t, h, compact) == mustHash(t, h, json.RawMessage(`{"a":[1,2],"b":"xy"}`)) {
+		t.Errorf("want whitespace within strings to matter")
+	}
+	if mustHash(t, h, json.RawMessage(`{"a":`)) == mustHash(t, h, json.RawMessage(`{"a" :`)) {
+		t.Errorf("want invalid JSON to hash as is")
+	}
+
+	diffs, err := h.Diff("xyz", doc{Body: compact}, doc{Body: indented})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+}
+
+func TestWithHash64(t *testing.T) {
+	table := crc64.MakeTable(crc64.ECMA)
+	var created int
+	h := deephash.New(deephash.WithHash64(func() hash.Hash64 {
+		created++
+		return crc64.New(table)
+	}))
+
+	got, err := h.Hash("foo")
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if expected := crc64.Checksum([]byte("foo"), table); got != expected {
+		t.Errorf("got %d, want %d", got, expected)
+	}
+
+	created = 0
+	m := map[string]int{"a": 1, "b": 2}
+	_, err = h.Hash(m)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if created != 3 {
+		t.Errorf("got %d hashes created, want map keys to be hashed with the backend too", created)
+	}
+
+	b, err := h.Canonical(m)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	got, err = h.Hash(m)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if expected := crc64.Checksum(b, table); got != expected {
+		t.Errorf("got %d, want the hash of the canonical bytes %d", got, expected)
+	}
+}
+
+func TestWithSeed(t *testing.T) {
+	seeded := func(src interface{}, opts ...deephash.Option) uint64 {
+		t.Helper()
+		v, err := deephash.HashWith(src, opts...)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		return v
+	}
+
+	m := map[string]int{"a": 1, "b": 2}
+	if seeded(m, deephash.WithSeed(1)) != seeded(m, deephash.WithSeed(1)) {
+		t.Errorf("want the same seed to be stable")
+	}
+	if seeded(m, deephash.WithSeed(1)) == seeded(m, deephash.WithSeed(2)) {
+		t.Errorf("want different seeds to diverge")
+	}
+	if seeded(m, deephash.WithSeed(1)) == seeded(m) {
+		t.Errorf("want a seed to change the hash")
+	}
+
+	// Options compose: each combination differs and applies every option
+	composed := []deephash.Option{
+		deephash.WithSeed(1),
+		deephash.WithHash64(func() hash.Hash64 { return crc64.New(crc64.MakeTable(crc64.ISO)) }),
+		deephash.WithMaxDepth(2),
+	}
+	all := seeded(chain(5, "a"), composed...)
+	if all != seeded(chain(5, "b"), composed...) {
+		t.Errorf("want the maximum depth to apply alongside the seed and backend")
+	}
+	for i := range composed {
+		without := append(append([]deephash.Option(nil), composed[:i]...), composed[i+1:]...)
+		if seeded(chain(5, "a"), without...) == all {
+			t.Errorf("want option %d to affect the hash", i)
+		}
+	}
+}
+
+type flags uint32
+
+func TestWithTypeIdentity(t *testing.T) {
+	h := deephash.New(deephash.WithTypeIdentity())
+
+	pairs := [][2]interface{}{
+		{flags(3), uint32(3)},
+		{time.Duration(5), int64(5)},
+		{int(3), int8(3)},
+		{label("a"), "a"},
+		{[]interface{}{flags(1)}, []interface{}{uint32(1)}},
+	}
+	for _, p := range pairs {
+		if deephash.Hash(p[0]) != deephash.Hash(p[1]) {
+			t.Fatalf("want %#v and %#v to hash equal without the option", p[0], p[1])
+		}
+		if mustHash(t, h, p[0]) == mustHash(t, h, p[1]) {
+			t.Errorf("want %#v and %#v to hash differently", p[0], p[1])
+		}
+	}
+	if mustHash(t, h, flags(3)) != mustHash(t, h, flags(3)) {
+		t.Errorf("want equal values of the same type to hash equal")
+	}
+	if mustHash(t, h, flags(3)) == mustHash(t, h, flags(4)) {
+		t.Errorf("want different values to hash differently")
+	}
+
+	diffs, err := h.Diff("xyz", []interface{}{flags(1), 2}, []interface{}{uint32(1), 2})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz[0] is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestWithStableFloat(t *testing.T) {
+	hash := func(src interface{}, scale int) uint64 {
+		t.Helper()
+		v, err := deephash.HashWith(src, deephash.WithStableFloat(scale))
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		return v
+	}
+
+	a, b := 0.1, 0.2
+	sum := a + b
+	if deephash.Hash(sum) == deephash.Hash(0.3) {
+		t.Fatalf("want 0.1+0.2 and 0.3 to hash differently without the option")
+	}
+	for _, tc := range []struct {
+		l, r  float64
+		scale int
+		equal bool
+	}{
+		{l: sum, r: 0.3, scale: 2, equal: true},
+		{l: sum, r: 0.3, scale: 10, equal: true},
+		{l: 1.1 * 1.1, r: 1.21, scale: 2, equal: true},
+		{l: 3 * 1.1, r: 3.3, scale: 6, equal: true},
+		{l: 0.31, r: 0.3, scale: 2, equal: false},
+		{l: 0.31, r: 0.3, scale: 1, equal: true},
+		{l: 1234, r: 1190, scale: -2, equal: true},
+		{l: math.Copysign(0, -1), r: 0, scale: 2, equal: true},
+		{l: math.Inf(1), r: math.Inf(-1), scale: 2, equal: false},
+	} {
+		if got := hash(tc.l, tc.scale) == hash(tc.r, tc.scale); got != tc.equal {
+			t.Errorf("got %t, want %t for %v and %v with scale %d", got, tc.equal, tc.l, tc.r, tc.scale)
+		}
+	}
+	if hash(float32(0.1), 4) != hash(0.1, 4) {
+		t.Errorf("want float32 and float64 values to hash equal once scaled")
+	}
+
+	h := deephash.New(deephash.WithStableFloat(2))
+	diffs, err := h.Diff("xyz", testStruct{F64: sum}, testStruct{F64: 0.3})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+}
+
+func TestWithSkipTypes(t *testing.T) {
+	type event struct {
+		Name    string
+		At      time.Time
+		Updated *time.Time
+		Meta    map[string]interface{}
+	}
+	now := time.Now()
+	later := now.Add(time.Hour)
+	a := event{Name: "a", At: now, Meta: map[string]interface{}{"seen": now}}
+	b := event{Name: "a", At: later, Updated: &later, Meta: map[string]interface{}{"seen": later}}
+
+	h := deephash.New(deephash.WithSkipTypes(reflect.TypeOf(time.Time{})))
+	ah, err := h.Hash(a)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	bh, err := h.Hash(b)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if ah != bh {
+		t.Errorf("got %d != %d, want every time.Time to be skipped", ah, bh)
+	}
+	if deephash.Hash(a) == deephash.Hash(b) {
+		t.Errorf("want times to affect the hash without the option")
+	}
+
+	diffs, err := h.Diff("xyz", a, b)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+
+	b.Name = "b"
+	diffs, err = h.Diff("xyz", a, b)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz.Name is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestWithTimeInstants(t *testing.T) {
+	type event struct {
+		Name string
+		At   time.Time
+	}
+	now := time.Now()
+	local := event{Name: "a", At: now}
+	utc := event{Name: "a", At: now.UTC()}
+	zoned := event{Name: "a", At: now.In(time.FixedZone("east", 3*60*60))}
+
+	h := deephash.New(deephash.WithTimeInstants())
+	lh, err := h.Hash(local)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	for _, other := range []event{utc, zoned} {
+		oh, err := h.Hash(other)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if oh != lh {
+			t.Errorf("got %d != %d, want the same instant to hash equal", oh, lh)
+		}
+
+		diffs, err := h.Diff("xyz", local, other)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if len(diffs) != 0 {
+			t.Errorf("got %#v, want no differences", diffs)
+		}
+	}
+	if deephash.Hash(local) == deephash.Hash(utc) {
+		t.Errorf("want the location to affect the hash without the option")
+	}
+
+	later := event{Name: "a", At: now.Add(time.Nanosecond)}
+	diffs, err := h.Diff("xyz", local, later)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz.At is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestWithDurationAsString(t *testing.T) {
+	h := deephash.New(deephash.WithDurationAsString())
+
+	for _, d := range []time.Duration{0, time.Nanosecond, 1500 * time.Millisecond, 90 * time.Minute, -time.Hour} {
+		if got, expected := mustHash(t, h, d), mustHash(t, h, d.String()); got != expected {
+			t.Errorf("got %d, want %s to hash like its string %d", got, d, expected)
+		}
+		if mustHash(t, h, d) != mustHash(t, h, time.Duration(int64(d))) {
+			t.Errorf("want equal durations to hash equal")
+		}
+		if mustHash(t, h, d) == mustHash(t, h, d+time.Second) {
+			t.Errorf("want %s and %s to hash differently", d, d+time.Second)
+		}
+		if deephash.Hash(d) != deephash.Hash(int64(d)) {
+			t.Errorf("want %s to hash like its nanoseconds without the option", d)
+		}
+	}
+
+	type timeout struct {
+		After time.Duration
+	}
+	c, err := h.Canonical(timeout{After: 90 * time.Minute})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if string(c) != "1h30m0s" {
+		t.Errorf("got %q, want the canonical bytes to be readable", c)
+	}
+}
+
+func TestWithMaxFields(t *testing.T) {
+	h := deephash.New(deephash.WithMaxFields(10))
+
+	large := make(map[int]int, 100)
+	for i := 0; i < 100; i++ {
+		large[i] = i
+	}
+	for name, src := range map[string]interface{}{
+		"map":   large,
+		"slice": make([]int, 11),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := h.Hash(src)
+			if !errors.Is(err, deephash.ErrTooManyFields) {
+				t.Errorf("got %#v, want ErrTooManyFields", err)
+			}
+
+			_, err = h.Diff("xyz", src, src)
+			if !errors.Is(err, deephash.ErrTooManyFields) {
+				t.Errorf("got %#v, want ErrTooManyFields", err)
+			}
+		})
+	}
+
+	got, err := h.Hash(make([]int, 10))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if expected := deephash.Hash(make([]int, 10)); got != expected {
+		t.Errorf("got %d, want the limit not to affect the hash %d", got, expected)
+	}
+}
+
+func TestWithIndexFormat(t *testing.T) {
+	h := deephash.New(deephash.WithIndexFormat(func(i int) string {
+		return fmt.Sprintf("%03d", i)
+	}))
+	l := []testStruct{{S: "a"}, {S: "b"}}
+	r := []testStruct{{S: "a"}, {S: "c"}}
+
+	diffs, err := h.Diff("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz[001].S is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	diffs, err = h.DiffSlicesLCS("xyz", []int{1, 2}, []int{0, 1, 2})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected = []string{"xyz[000] inserted"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	lh, err := h.Hash(l)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if expected := deephash.Hash(l); lh != expected {
+		t.Errorf("got %d, want the index format not to affect the hash %d", lh, expected)
+	}
+}
+
+func TestWithMapValuesOnly(t *testing.T) {
+	h := deephash.New(deephash.WithMapValuesOnly())
+
+	if mustHash(t, h, map[string]int{"a": 1}) != mustHash(t, h, map[string]int{"b": 1}) {
+		t.Errorf("want maps with the same values under different keys to hash equal")
+	}
+	if mustHash(t, h, map[string]int{"a": 1, "b": 2}) != mustHash(t, h, map[int]int{7: 2, 8: 1}) {
+		t.Errorf("want the keys to be ignored")
+	}
+	if mustHash(t, h, map[string]int{"a": 1}) == mustHash(t, h, map[string]int{"a": 2}) {
+		t.Errorf("want different values to hash differently")
+	}
+	if mustHash(t, h, map[string]int{"a": 1, "b": 1}) == mustHash(t, h, map[string]int{"a": 1}) {
+		t.Errorf("want repeated values to be retained")
+	}
+	if deephash.Hash(map[string]int{"a": 1}) == deephash.Hash(map[string]int{"b": 1}) {
+		t.Errorf("want keys to affect the hash without the option")
+	}
+
+	diffs, err := h.Diff("xyz", map[string]int{"a": 1, "b": 2}, map[string]int{"c": 1, "d": 3})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) == 0 {
+		t.Errorf("want a differing value to be reported")
+	}
+	diffs, err = h.Diff("xyz", map[string]int{"a": 1}, map[string]int{"b": 1})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("got %#v, want no differences", diffs)
+	}
+}
+
+func TestWithGobCanonical(t *testing.T) {
+	type record struct {
+		ID     string
+		Scores []int
+		At     time.Time
+		Next   *record
+	}
+	h := deephash.New(deephash.WithGobCanonical())
+	now := time.Now()
+	build := func() record {
+		return record{ID: "a", Scores: []int{1, 2}, At: now, Next: &record{ID: "b"}}
+	}
+
+	expected, err := h.Hash(build())
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	for i := 0; i < 10; i++ {
+		got, err := h.Hash(build())
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		if got != expected {
+			t.Fatalf("got %d, want %d", got, expected)
+		}
+	}
+
+	// A second message of a gob stream ends with the encoding of the value
+	// alone, its type having been sent by the first
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		err = enc.Encode(build())
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+	}
+	b, err := h.Canonical(build())
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	name := []byte("moqueries.org/deephash_test.record\x00")
+	if !bytes.HasPrefix(b, name) || !bytes.HasSuffix(buf.Bytes(), b[len(name):]) {
+		t.Errorf("got %x, want the type name then the end of the gob message %x", b, buf.Bytes())
+	}
+
+	// Type IDs of gob streams depend on the types a process encoded first
+	type gobFirst struct {
+		A string
+	}
+	type gobSecond struct {
+		C int
+		D []string
+	}
+	err = gob.NewEncoder(&buf).Encode(gobFirst{A: "a"})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if got := mustHash(t, h, gobSecond{C: 3, D: []string{"x"}}); got != 0x38a48799a806888d {
+		t.Errorf("got %#x, want the hash to be independent of the types gob encoded before", got)
+	}
+
+	z := 0
+	type optional struct {
+		P *int
+	}
+	if mustHash(t, h, optional{}) != mustHash(t, h, optional{P: &z}) {
+		t.Errorf("want a nil pointer to hash like a pointer to zero as gob omits both")
+	}
+
+	other := build()
+	other.Next.ID = "c"
+	if got, err := h.Hash(other); err != nil || got == expected {
+		t.Errorf("got %d, %#v, want a different hash and no error", got, err)
+	}
+
+	for _, src := range []interface{}{
+		map[string]int{"a": 1},
+		struct{ M map[string]int }{},
+		struct{ I interface{} }{},
+	} {
+		if _, err := h.Hash(src); err == nil {
+			t.Errorf("want an error for %#v", src)
+		}
+	}
+}
+
+func TestWithTypeChanges(t *testing.T) {
+	h := deephash.New(deephash.WithTypeChanges())
+	l := testStruct{S: "a", Interface: testStruct{I: 42}}
+	r := testStruct{S: "b", Interface: 42}
+
+	diffs, err := h.Diff("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{
+		"xyz.S is not equal",
+		"xyz.Interface: type changed (testStruct vs int)",
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+	if plain := deephash.Diff("xyz", l, r); len(plain) <= len(expected) {
+		t.Errorf("got %#v, want more differences without the option", plain)
+	}
+
+	diffs, err = h.Diff("xyz", r, l)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected = []string{
+		"xyz.S is not equal",
+		"xyz.Interface: type changed (int vs testStruct)",
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	diffs, err = h.Diff("xyz", map[string]interface{}{"a": []int{1}, "b": 1}, map[string]interface{}{"a": "1", "b": 2})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	sort.Strings(diffs)
+	expected = []string{
+		"xyz[a]: type changed ([]int vs string)",
+		"xyz[b] is not equal",
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	paths, err := h.DiffPaths("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if expected := []string{"xyz.S", "xyz.Interface"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("got %#v, want %#v", paths, expected)
+	}
+}
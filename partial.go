@@ -0,0 +1,72 @@
+package deephash
+
+import (
+	"reflect"
+	"strings"
+)
+
+// HashPartial returns a fnv64a hash of the part of src at or below
+// pathPrefix
+func HashPartial(src interface{}, pathPrefix string) (uint64, error) {
+	return defaultHasher.HashPartial(src, pathPrefix)
+}
+
+// HashPartial returns the hash of the part of src at or below pathPrefix,
+// for instance "value.Database" to hash only the Database field of src. The
+// whole of src is traversed but only the leaves whose path is pathPrefix or
+// is nested below it contribute to the hash, so changes elsewhere in src
+// don't affect it. Paths are those reported by Diff with its default root
+// of "value".
+func (h *Hasher) HashPartial(src interface{}, pathPrefix string) (uint64, error) {
+	fh := h.cfg.newHash()
+	err := h.cfg.writeHeader(fh, h.cfg.initBytes)
+	if err != nil {
+		return 0, err
+	}
+	err = h.cfg.writeSchema(fh, reflect.TypeOf(src))
+	if err != nil {
+		return 0, err
+	}
+	pw := prefixWriter{w: noopFieldWriter{fh}, prefix: pathPrefix}
+	err = h.traverse(reflect.ValueOf(src), "value", pw)
+	if err != nil {
+		return 0, err
+	}
+	return fh.Sum64(), nil
+}
+
+// prefixWriter writes only the fields at or below prefix to w
+type prefixWriter struct {
+	w      noopFieldWriter
+	prefix string
+}
+
+func (w prefixWriter) Write(f string, k reflect.Kind, p []byte) error {
+	if !hasPathPrefix(f, w.prefix) {
+		return nil
+	}
+	return w.w.Write(f, k, p)
+}
+
+func (w prefixWriter) WriteKey(f string, p []byte) error {
+	if !hasPathPrefix(f, w.prefix) {
+		return nil
+	}
+	return w.w.WriteKey(f, p)
+}
+
+// hasPathPrefix returns true when f is prefix or is nested below it
+func hasPathPrefix(f, prefix string) bool {
+	if !strings.HasPrefix(f, prefix) {
+		return false
+	}
+	if len(f) == len(prefix) {
+		return true
+	}
+	switch f[len(prefix)] {
+	case '.', '[', '(':
+		return true
+	default:
+		return false
+	}
+}
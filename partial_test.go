@@ -0,0 +1,65 @@
+package deephash_test
+
+import (
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+func TestHashPartial(t *testing.T) {
+	type database struct {
+		Host string
+		Port int
+	}
+	type config struct {
+		Name      string
+		Database  database
+		DatabaseX string
+		Tags      map[string]string
+	}
+	base := config{
+		Name:      "svc",
+		Database:  database{Host: "db", Port: 5432},
+		DatabaseX: "x",
+		Tags:      map[string]string{"env": "prod", "team": "core"},
+	}
+
+	hash := func(c config, prefix string) uint64 {
+		t.Helper()
+		h, err := deephash.HashPartial(c, prefix)
+		if err != nil {
+			t.Fatalf("got %#v, want no error", err)
+		}
+		return h
+	}
+
+	db := hash(base, "value.Database")
+	sibling := base
+	sibling.Name = "other"
+	sibling.DatabaseX = "y"
+	sibling.Tags = nil
+	if got := hash(sibling, "value.Database"); got != db {
+		t.Errorf("got %d, want sibling changes to be ignored %d", got, db)
+	}
+
+	changed := base
+	changed.Database.Port = 5433
+	if got := hash(changed, "value.Database"); got == db {
+		t.Errorf("got %d, want a change in the subtree to change the hash", got)
+	}
+
+	env := hash(base, "value.Tags[env]")
+	other := base
+	other.Tags = map[string]string{"env": "prod", "team": "edge"}
+	if got := hash(other, "value.Tags[env]"); got != env {
+		t.Errorf("got %d, want other map keys to be ignored %d", got, env)
+	}
+	other.Tags = map[string]string{"env": "dev"}
+	if got := hash(other, "value.Tags[env]"); got == env {
+		t.Errorf("got %d, want a change to the map value to change the hash", got)
+	}
+
+	if got := hash(sibling, "value"); got == hash(base, "value") {
+		t.Errorf("got %d, want the root prefix to hash the whole value", got)
+	}
+}
@@ -0,0 +1,120 @@
+package deephash
+
+// SegmentKind identifies what a PathSegment refers to
+type SegmentKind int
+
+const (
+	// FieldSegment is a struct field, named by PathSegment.Name
+	FieldSegment SegmentKind = iota + 1
+	// IndexSegment is an element of a slice or array, at PathSegment.Index
+	IndexSegment
+	// KeySegment is the value of a map entry, for the key named by
+	// PathSegment.Key
+	KeySegment
+	// TypeSegment is the dynamic type, named by PathSegment.Name, of a value
+	// held in an interface. It only appears with WithTypeNames.
+	TypeSegment
+)
+
+// PathSegment is a single step of the path to a difference
+type PathSegment struct {
+	Kind SegmentKind
+	// Name is the name of a struct field, after any WithFieldNameMapper, or
+	// of a dynamic type
+	Name string
+	// Index is the index of a slice or array element
+	Index int
+	// Key is the name of a map key, as it appears in Diff paths
+	Key string
+}
+
+// Change describes how a value differs
+type Change int
+
+const (
+	// Modified values are present on both sides but aren't equal
+	Modified Change = iota + 1
+	// Added map keys are only present on the right side
+	Added
+	// Removed map keys are only present on the left side
+	Removed
+)
+
+// Difference is a single difference reported by DiffDetailed
+type Difference struct {
+	// Path is the path of the difference as it appears in Diff
+	Path string
+	// Segments are the steps from the root to the difference. The root
+	// itself isn't included, so a difference at the root has no segments.
+	Segments []PathSegment
+	Change   Change
+	// Left and Right are the contents of a differing byte slice, compared
+	// as a whole with WithByteFastPath, on each side rendered as hex. They
+	// are empty for other values and for a side where the slice is absent.
+	Left  string
+	Right string
+}
+
+// DiffDetailed returns the differences between lSrc and rSrc
+func DiffDetailed(field string, lSrc, rSrc interface{}) []Difference {
+	diffs, err := defaultHasher.DiffDetailed(field, lSrc, rSrc)
+	if err != nil {
+		panic(err)
+	}
+	return diffs
+}
+
+// DiffDetailed returns the differences between lSrc and rSrc like Diff,
+// but with the path of each difference broken into segments, so that paths
+// can be rendered in any form, for instance as a JSON Pointer
+func (h *Hasher) DiffDetailed(field string, lSrc, rSrc interface{}) ([]Difference, error) {
+	cw := newCompareWriter()
+	cw.countOnly = true
+	cw.segments = make(map[string][]PathSegment)
+	cw.lBytes = make(map[string][]byte)
+	cw.rBytes = make(map[string][]byte)
+	err := h.compare(field, lSrc, rSrc, cw)
+	if err != nil {
+		return nil, err
+	}
+	return cw.details, nil
+}
+
+// pushSegment appends seg to the path of the value being traversed when
+// tracking paths
+func (w *walker) pushSegment(seg PathSegment) {
+	if w.segments != nil {
+		w.path = append(w.path, seg)
+	}
+}
+
+// popSegment removes the last segment pushed by pushSegment
+func (w *walker) popSegment() {
+	if w.segments != nil {
+		w.path = w.path[:len(w.path)-1]
+	}
+}
+
+// recordSegments remembers the segments of the path to field when tracking
+// paths
+func (w *walker) recordSegments(field string) {
+	if w.segments == nil {
+		return
+	}
+	if _, ok := w.segments[field]; ok {
+		return
+	}
+	w.segments[field] = append([]PathSegment(nil), w.path...)
+}
+
+// changeOf returns the Change described by the diff message msg
+func changeOf(msg string) Change {
+	switch msg {
+	case added:
+		return Added
+	case removed:
+		return Removed
+	default:
+		return Modified
+	}
+}
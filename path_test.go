@@ -0,0 +1,165 @@
+package deephash_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+type order struct {
+	ID    string
+	Lines []orderLine
+	Attrs map[string]orderLine
+}
+
+type orderLine struct {
+	SKU string
+	Qty int
+}
+
+func TestDiffDetailed(t *testing.T) {
+	l := order{
+		ID:    "a",
+		Lines: []orderLine{{SKU: "x", Qty: 1}},
+		Attrs: map[string]orderLine{"gift": {Qty: 1}, "old": {}},
+	}
+	r := order{
+		ID:    "b",
+		Lines: []orderLine{{SKU: "x", Qty: 2}},
+		Attrs: map[string]orderLine{"gift": {Qty: 2}, "new": {}},
+	}
+
+	diffs := deephash.DiffDetailed("xyz", l, r)
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	expected := []deephash.Difference{
+		{
+			Path: "xyz.Attrs[gift].Qty",
+			Segments: []deephash.PathSegment{
+				{Kind: deephash.FieldSegment, Name: "Attrs"},
+				{Kind: deephash.KeySegment, Key: "gift"},
+				{Kind: deephash.FieldSegment, Name: "Qty"},
+			},
+			Change: deephash.Modified,
+		},
+		{
+			Path: "xyz.Attrs[new]",
+			Segments: []deephash.PathSegment{
+				{Kind: deephash.FieldSegment, Name: "Attrs"},
+				{Kind: deephash.KeySegment, Key: "new"},
+			},
+			Change: deephash.Added,
+		},
+		{
+			Path: "xyz.Attrs[old]",
+			Segments: []deephash.PathSegment{
+				{Kind: deephash.FieldSegment, Name: "Attrs"},
+				{Kind: deephash.KeySegment, Key: "old"},
+			},
+			Change: deephash.Removed,
+		},
+		{
+			Path:     "xyz.ID",
+			Segments: []deephash.PathSegment{{Kind: deephash.FieldSegment, Name: "ID"}},
+			Change:   deephash.Modified,
+		},
+		{
+			Path: "xyz.Lines[0].Qty",
+			Segments: []deephash.PathSegment{
+				{Kind: deephash.FieldSegment, Name: "Lines"},
+				{Kind: deephash.IndexSegment, Index: 0},
+				{Kind: deephash.FieldSegment, Name: "Qty"},
+			},
+			Change: deephash.Modified,
+		},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	var paths []string
+	for _, d := range diffs {
+		paths = append(paths, d.Path)
+	}
+	plain := deephash.DiffPaths("xyz", l, r)
+	sort.Strings(plain)
+	if !reflect.DeepEqual(paths, plain) {
+		t.Errorf("got %#v, want %#v", paths, plain)
+	}
+
+	diffs = deephash.DiffDetailed("xyz", 1, 2)
+	expected = []deephash.Difference{{Path: "xyz", Change: deephash.Modified}}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+}
+
+func TestDiffDetailedTypeNames(t *testing.T) {
+	h := deephash.New(deephash.WithTypeNames(), deephash.WithSortedSlices())
+	diffs, err := h.DiffDetailed("xyz",
+		testStruct{Interface: []int{1, 2}},
+		testStruct{Interface: []int{1, 3}})
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	for _, d := range diffs {
+		expected := []deephash.PathSegment{
+			{Kind: deephash.FieldSegment, Name: "Interface"},
+			{Kind: deephash.TypeSegment, Name: "[]int"},
+			{Kind: deephash.IndexSegment, Index: d.Segments[len(d.Segments)-1].Index},
+		}
+		if !reflect.DeepEqual(d.Segments, expected) {
+			t.Errorf("got %#v, want %#v", d.Segments, expected)
+		}
+	}
+	if len(diffs) == 0 {
+		t.Errorf("want differences")
+	}
+}
+
+func TestDiffDetailedBytes(t *testing.T) {
+	type blob struct {
+		Key  []byte
+		Data [4]byte
+		Same []byte
+	}
+	l := blob{Key: []byte{0x01, 0x02, 0x03}, Data: [4]byte{0xde, 0xad}, Same: []byte("x")}
+	r := blob{Key: []byte{0x01, 0x02, 0x04, 0x05}, Data: [4]byte{0xbe, 0xef}, Same: []byte("x")}
+	h := deephash.New(deephash.WithByteFastPath())
+
+	diffs, err := h.Diff("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expected := []string{"xyz.Key is not equal", "xyz.Data is not equal"}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %#v, want %#v", diffs, expected)
+	}
+
+	details, err := h.DiffDetailed("xyz", l, r)
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	expectedDetails := []deephash.Difference{
+		{
+			Path:     "xyz.Key",
+			Segments: []deephash.PathSegment{{Kind: deephash.FieldSegment, Name: "Key"}},
+			Change:   deephash.Modified,
+			Left:     "010203",
+			Right:    "01020405",
+		},
+		{
+			Path:     "xyz.Data",
+			Segments: []deephash.PathSegment{{Kind: deephash.FieldSegment, Name: "Data"}},
+			Change:   deephash.Modified,
+			Left:     "dead0000",
+			Right:    "beef0000",
+		},
+	}
+	if !reflect.DeepEqual(details, expectedDetails) {
+		t.Errorf("got %#v, want %#v", details, expectedDetails)
+	}
+}
@@ -0,0 +1,103 @@
+package deephash
+
+import (
+	"errors"
+	"io"
+	"reflect"
+)
+
+// HashReader returns a fnv64a hash of the bytes read from r until EOF
+func HashReader(r io.Reader) (uint64, error) {
+	return defaultHasher.HashReader(r)
+}
+
+// HashReader returns the hash of the bytes read from r until EOF, streaming
+// them into the hash in chunks rather than reading them into memory. The
+// bytes are hashed exactly like a []byte holding the same bytes is hashed by
+// a Hasher configured with WithByteFastPath, including when the []byte is
+// hashed as a string by WithByteSliceAsString or WithRuneStringEquivalence
+// and when an empty []byte writes a leaf with WithDistinctEmpty. Unless kind
+// tags, container tags, length prefixes or string normalization are
+// configured, this is also the hash of the equivalent string.
+//
+// With WithLengthPrefix, r must report the number of bytes left to read via
+// a Len method, like *bytes.Reader and *strings.Reader do, as the length is
+// written before the bytes. With WithStringNormalization, bytes hashed as a
+// string are read into memory as they are normalized as a whole.
+func (h *Hasher) HashReader(r io.Reader) (uint64, error) {
+	fh := h.cfg.newHash()
+	err := h.cfg.writeHeader(fh, h.cfg.initBytes)
+	if err != nil {
+		return 0, err
+	}
+	err = h.cfg.writeSchema(fh, reflect.TypeOf([]byte(nil)))
+	if err != nil {
+		return 0, err
+	}
+
+	// Mirrors the branches taken by deepHash for a []byte
+	w := h.walker(noopFieldWriter{fh})
+	defer w.release()
+	str := h.cfg.byteStrings || h.cfg.runeStrings
+	if str && h.cfg.normalizeString != nil {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return 0, err
+		}
+		err = w.writeString(string(b))
+		if err != nil {
+			return 0, err
+		}
+		return fh.Sum64(), nil
+	}
+
+	// The length is read before any byte is, and the first chunk is read
+	// before anything is written to tell whether r is empty
+	length := -1
+	if h.cfg.lengthPrefix && !str {
+		lr, ok := r.(interface{ Len() int })
+		if !ok {
+			return 0, errors.New("HashReader with a length prefix requires a reader with a Len method")
+		}
+		length = lr.Len()
+	}
+	buf := make([]byte, chunkSize)
+	n, err := io.ReadAtLeast(r, buf, 1)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	switch {
+	case str:
+		if h.cfg.kindTags {
+			_, _ = fh.Write([]byte{byte(reflect.String)})
+		}
+	case n == 0 && h.cfg.distinctEmpty:
+		err = w.writeEmpty(reflect.ValueOf([]byte{}))
+		if err != nil {
+			return 0, err
+		}
+		return fh.Sum64(), nil
+	default:
+		if length >= 0 {
+			err = w.writeLength(reflect.Slice, length)
+			if err != nil {
+				return 0, err
+			}
+		}
+		err = w.writeContainerTag(reflect.Slice)
+		if err != nil {
+			return 0, err
+		}
+		if h.cfg.kindTags {
+			_, _ = fh.Write([]byte{byte(reflect.Slice)})
+		}
+	}
+
+	_, _ = fh.Write(buf[:n])
+	_, err = io.CopyBuffer(fh, r, buf)
+	if err != nil {
+		return 0, err
+	}
+	return fh.Sum64(), nil
+}
@@ -0,0 +1,72 @@
+package deephash_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+func TestHashReader(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+	for name, opts := range map[string][]deephash.Option{
+		"plain":          nil,
+		"kind tags":      {deephash.WithKindTags()},
+		"container tags": {deephash.WithContainerTags()},
+		"length prefix":  {deephash.WithLengthPrefix()},
+		"init bytes":     {deephash.WithInitBytes([]byte("ns:")), deephash.WithVersionPrefix()},
+		"distinct empty": {deephash.WithDistinctEmpty()},
+		"distinct empty, length prefix": {
+			deephash.WithDistinctEmpty(), deephash.WithLengthPrefix(), deephash.WithContainerTags(),
+		},
+		"distinct empty, type identity": {deephash.WithDistinctEmpty(), deephash.WithTypeIdentity()},
+		"byte slice as string":          {deephash.WithByteSliceAsString()},
+		"byte slice as string, kind tags": {
+			deephash.WithByteSliceAsString(), deephash.WithKindTags(), deephash.WithLengthPrefix(),
+		},
+		"byte slice as string, distinct empty": {deephash.WithByteSliceAsString(), deephash.WithDistinctEmpty()},
+		"byte slice as string, normalization": {
+			deephash.WithByteSliceAsString(), deephash.WithStringNormalization(strings.ToUpper), deephash.WithKindTags(),
+		},
+		"rune strings": {deephash.WithRuneStringEquivalence()},
+		"rune strings, kind tags": {
+			deephash.WithRuneStringEquivalence(), deephash.WithKindTags(), deephash.WithContainerTags(),
+		},
+		"rune strings, normalization": {
+			deephash.WithRuneStringEquivalence(), deephash.WithStringNormalization(strings.ToUpper),
+		},
+		"normalization": {deephash.WithStringNormalization(strings.ToUpper), deephash.WithKindTags()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := deephash.New(append(opts, deephash.WithByteFastPath())...)
+			for _, b := range [][]byte{nil, {}, []byte("foo"), large} {
+				expected, err := h.Hash(b)
+				if err != nil {
+					t.Fatalf("got %#v, want no error", err)
+				}
+				got, err := h.HashReader(bytes.NewReader(b))
+				if err != nil {
+					t.Fatalf("got %#v, want no error", err)
+				}
+				if got != expected {
+					t.Errorf("got %d, want %d for %d bytes", got, expected, len(b))
+				}
+			}
+		})
+	}
+
+	got, err := deephash.HashReader(strings.NewReader("foo"))
+	if err != nil {
+		t.Fatalf("got %#v, want no error", err)
+	}
+	if got != deephash.Hash("foo") {
+		t.Errorf("got %d, want the hash of the equivalent string %d", got, deephash.Hash("foo"))
+	}
+
+	_, err = deephash.New(deephash.WithLengthPrefix()).HashReader(io.MultiReader(strings.NewReader("foo")))
+	if err == nil {
+		t.Errorf("want an error for a reader without a length")
+	}
+}
@@ -0,0 +1,82 @@
+package deephash
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// writeSchema writes the fingerprint of the structure of t when hashing with
+// schema fingerprints
+func (c *config) writeSchema(w io.Writer, t reflect.Type) error {
+	if !c.schemaFingerprint {
+		return nil
+	}
+	var b strings.Builder
+	writeTypeSchema(&b, t, make(map[reflect.Type]struct{}))
+	fh := fnv.New64a()
+	_, _ = io.WriteString(fh, b.String())
+	p := make([]byte, 8)
+	binary.BigEndian.PutUint64(p, fh.Sum64())
+	_, err := w.Write(p)
+	return err
+}
+
+// writeTypeSchema writes a description of the structure of t to b, including
+// the names and types of the fields of every struct reachable from t, even
+// through named slices, maps, arrays and pointers. Named types already being
+// described further up are written by name only so that recursive types
+// terminate.
+func writeTypeSchema(b *strings.Builder, t reflect.Type, seen map[reflect.Type]struct{}) {
+	if t == nil {
+		b.WriteString("nil")
+		return
+	}
+	if t.Name() != "" {
+		b.WriteString(typeID(t))
+		switch t.Kind() {
+		case reflect.Struct, reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			return
+		}
+		if _, ok := seen[t]; ok {
+			return
+		}
+		seen[t] = struct{}{}
+		defer delete(seen, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		b.WriteString("struct{")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if i > 0 {
+				b.WriteString("; ")
+			}
+			b.WriteString(f.Name)
+			b.WriteByte(' ')
+			writeTypeSchema(b, f.Type, seen)
+		}
+		b.WriteByte('}')
+	case reflect.Ptr:
+		b.WriteByte('*')
+		writeTypeSchema(b, t.Elem(), seen)
+	case reflect.Slice:
+		b.WriteString("[]")
+		writeTypeSchema(b, t.Elem(), seen)
+	case reflect.Array:
+		b.WriteString("[" + strconv.Itoa(t.Len()) + "]")
+		writeTypeSchema(b, t.Elem(), seen)
+	case reflect.Map:
+		b.WriteString("map[")
+		writeTypeSchema(b, t.Key(), seen)
+		b.WriteByte(']')
+		writeTypeSchema(b, t.Elem(), seen)
+	default:
+		b.WriteString(t.String())
+	}
+}
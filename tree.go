@@ -0,0 +1,143 @@
+package deephash
+
+import (
+	"reflect"
+	"sort"
+)
+
+// DiffNode is a node of the tree of differences returned by DiffTree. The
+// tree mirrors the nesting of the values compared, but only holds the
+// nodes leading to a difference.
+type DiffNode struct {
+	// Segment is the step from the parent node to this one. The root has
+	// no segment.
+	Segment PathSegment
+	// Change describes how the value at this node differs. Nodes above a
+	// difference are Modified. Change is zero for the root when the values
+	// are equal.
+	Change Change
+	// Left and Right are the values on each side of a difference. A side
+	// is nil where the value is absent, such as the left side of an added
+	// map key, or can't be retrieved, such as a struct held by an
+	// unexported field. Both are nil for the nodes above a difference.
+	Left  interface{}
+	Right interface{}
+	// Children are the nodes below this one, ordered by kind then by
+	// field name, index or key
+	Children []*DiffNode
+}
+
+// DiffTree returns the differences between lSrc and rSrc as a tree
+func DiffTree(lSrc, rSrc interface{}) *DiffNode {
+	root, err := defaultHasher.DiffTree(lSrc, rSrc)
+	if err != nil {
+		panic(err)
+	}
+	return root
+}
+
+// DiffTree returns the differences between lSrc and rSrc as a tree rather
+// than as a flat list, for instance to render them as collapsible nodes.
+// Each difference is a leaf of the tree carrying the values on both sides.
+func (h *Hasher) DiffTree(lSrc, rSrc interface{}) (*DiffNode, error) {
+	cw := newCompareWriter()
+	cw.countOnly = true
+	cw.segments = make(map[string][]PathSegment)
+	cw.lBytes = make(map[string][]byte)
+	cw.rBytes = make(map[string][]byte)
+	cw.lValues = make(map[string]interface{})
+	cw.rValues = make(map[string]interface{})
+	err := h.compare("", lSrc, rSrc, cw)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &DiffNode{}
+	for _, d := range cw.details {
+		n := root
+		for _, seg := range d.Segments {
+			n.Change = Modified
+			n = n.child(seg)
+		}
+		n.Change = d.Change
+		n.Left = cw.lValues[d.Path]
+		n.Right = cw.rValues[d.Path]
+	}
+	root.sort()
+	return root, nil
+}
+
+// child returns the child of n at seg, adding it if needed
+func (n *DiffNode) child(seg PathSegment) *DiffNode {
+	for _, c := range n.Children {
+		if c.Segment == seg {
+			return c
+		}
+	}
+	c := &DiffNode{Segment: seg}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// sort orders the children of n and of its descendants
+func (n *DiffNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := n.Children[i].Segment, n.Children[j].Segment
+		switch {
+		case a.Kind != b.Kind:
+			return a.Kind < b.Kind
+		case a.Index != b.Index:
+			return a.Index < b.Index
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		default:
+			return a.Key < b.Key
+		}
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// recordValue remembers src as the value at the path being traversed when
+// building a tree of differences
+func (w *walker) recordValue(src reflect.Value) {
+	if w.cw == nil || w.cw.lValues == nil {
+		return
+	}
+	v := interfaceOf(src)
+	if w.cw.comparing {
+		w.cw.rValues[w.field()] = v
+	} else {
+		w.cw.lValues[w.field()] = v
+	}
+}
+
+// interfaceOf returns the value held by src, or nil if it can't be
+// retrieved. The values of basic kinds are copied out of unexported fields.
+func interfaceOf(src reflect.Value) interface{} {
+	if !src.IsValid() {
+		return nil
+	}
+	if src.CanInterface() {
+		return src.Interface()
+	}
+	var v reflect.Value
+	switch src.Kind() {
+	case reflect.Bool:
+		v = reflect.ValueOf(src.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v = reflect.ValueOf(src.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v = reflect.ValueOf(src.Uint())
+	case reflect.Float32, reflect.Float64:
+		v = reflect.ValueOf(src.Float())
+	case reflect.Complex64, reflect.Complex128:
+		v = reflect.ValueOf(src.Complex())
+	case reflect.String:
+		v = reflect.ValueOf(src.String())
+	default:
+		return nil
+	}
+	return v.Convert(src.Type()).Interface()
+}
@@ -0,0 +1,98 @@
+package deephash_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+func TestDiffTree(t *testing.T) {
+	l := order{
+		ID:    "a",
+		Lines: []orderLine{{SKU: "x", Qty: 1}, {SKU: "y", Qty: 1}},
+		Attrs: map[string]orderLine{"gift": {Qty: 1}, "old": {}},
+	}
+	r := order{
+		ID:    "b",
+		Lines: []orderLine{{SKU: "x", Qty: 1}, {SKU: "y", Qty: 3}},
+		Attrs: map[string]orderLine{"gift": {Qty: 1}, "new": {SKU: "z"}},
+	}
+
+	got := deephash.DiffTree(l, r)
+	expected := &deephash.DiffNode{
+		Change: deephash.Modified,
+		Children: []*deephash.DiffNode{
+			{
+				Segment: deephash.PathSegment{Kind: deephash.FieldSegment, Name: "Attrs"},
+				Change:  deephash.Modified,
+				Children: []*deephash.DiffNode{
+					{
+						Segment: deephash.PathSegment{Kind: deephash.KeySegment, Key: "new"},
+						Change:  deephash.Added,
+						Right:   orderLine{SKU: "z"},
+					},
+					{
+						Segment: deephash.PathSegment{Kind: deephash.KeySegment, Key: "old"},
+						Change:  deephash.Removed,
+						Left:    orderLine{},
+					},
+				},
+			},
+			{
+				Segment: deephash.PathSegment{Kind: deephash.FieldSegment, Name: "ID"},
+				Change:  deephash.Modified,
+				Left:    "a",
+				Right:   "b",
+			},
+			{
+				Segment: deephash.PathSegment{Kind: deephash.FieldSegment, Name: "Lines"},
+				Change:  deephash.Modified,
+				Children: []*deephash.DiffNode{
+					{
+						Segment: deephash.PathSegment{Kind: deephash.IndexSegment, Index: 1},
+						Change:  deephash.Modified,
+						Children: []*deephash.DiffNode{
+							{
+								Segment: deephash.PathSegment{Kind: deephash.FieldSegment, Name: "Qty"},
+								Change:  deephash.Modified,
+								Left:    1,
+								Right:   3,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %s, want %s", renderTree(got), renderTree(expected))
+	}
+
+	if got := deephash.DiffTree(l, l); got.Change != 0 || len(got.Children) != 0 {
+		t.Errorf("got %s, want an empty root for equal values", renderTree(got))
+	}
+
+	root := deephash.DiffTree(1, 2)
+	if root.Change != deephash.Modified || root.Left != 1 || root.Right != 2 || len(root.Children) != 0 {
+		t.Errorf("got %s, want the root itself to differ", renderTree(root))
+	}
+
+	type private struct {
+		n int
+	}
+	root = deephash.DiffTree(private{n: 1}, private{n: 2})
+	if len(root.Children) != 1 || root.Children[0].Left != 1 || root.Children[0].Right != 2 {
+		t.Errorf("got %s, want the values of unexported fields", renderTree(root))
+	}
+}
+
+// renderTree renders n and its descendants for test failures
+func renderTree(n *deephash.DiffNode) string {
+	s := fmt.Sprintf("{%+v %d %v %v [", n.Segment, n.Change, n.Left, n.Right)
+	for _, c := range n.Children {
+		s += renderTree(c)
+	}
+	return s + "]}"
+}
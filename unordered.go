@@ -0,0 +1,68 @@
+package deephash
+
+import "reflect"
+
+// DiffIgnoringOrder returns a list of differences between the slices or
+// arrays lSrc and rSrc, comparing them as multisets
+func DiffIgnoringOrder(lSrc, rSrc interface{}) []string {
+	diffs, err := defaultHasher.DiffIgnoringOrder(lSrc, rSrc)
+	if err != nil {
+		panic(err)
+	}
+	return diffs
+}
+
+// DiffIgnoringOrder returns a list of differences between the slices or
+// arrays lSrc and rSrc, comparing them as multisets of element hashes. Each
+// element of lSrc without an equal counterpart in rSrc is reported as
+// removed at its index in lSrc, then each element of rSrc without an equal
+// counterpart in lSrc is reported as added at its index in rSrc. Duplicates
+// are matched one for one, so []int{1, 1} and []int{1} differ by one
+// removed element. Elements that differ are never compared field by field.
+//
+// If either lSrc or rSrc isn't a slice or an array, DiffIgnoringOrder is
+// equivalent to Diff.
+func (h *Hasher) DiffIgnoringOrder(lSrc, rSrc interface{}) ([]string, error) {
+	const field = "value"
+
+	l := indirect(reflect.ValueOf(lSrc))
+	r := indirect(reflect.ValueOf(rSrc))
+	if !isList(l) || !isList(r) {
+		return h.Diff(field, lSrc, rSrc)
+	}
+
+	lh, err := h.elementHashes(field, l)
+	if err != nil {
+		return nil, err
+	}
+	rh, err := h.elementHashes(field, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// unmatched holds the indexes of elements of rSrc not yet matched to an
+	// element of lSrc, by their hash
+	unmatched := make(map[uint64][]int, len(rh))
+	for j, eh := range rh {
+		unmatched[eh] = append(unmatched[eh], j)
+	}
+
+	var out []string
+	matched := make([]bool, len(rh))
+	for i, eh := range lh {
+		js := unmatched[eh]
+		if len(js) == 0 {
+			out = append(out, h.cfg.indexPath(field, i)+removed)
+			continue
+		}
+		matched[js[0]] = true
+		unmatched[eh] = js[1:]
+	}
+	for j, m := range matched {
+		if !m {
+			out = append(out, h.cfg.indexPath(field, j)+added)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,62 @@
+package deephash_test
+
+import (
+	"reflect"
+	"testing"
+
+	"moqueries.org/deephash"
+)
+
+func TestDiffIgnoringOrder(t *testing.T) {
+	testCases := map[string]struct {
+		l, r     interface{}
+		expected []string
+	}{
+		"permuted": {
+			l: []int{1, 2, 3},
+			r: []int{3, 1, 2},
+		},
+		"permuted structs": {
+			l: []testStruct{{S: "a"}, {S: "b"}},
+			r: &[]testStruct{{S: "b"}, {S: "a"}},
+		},
+		"array and slice": {
+			l: [3]string{"a", "b", "c"},
+			r: []string{"c", "b", "a"},
+		},
+		"added": {
+			l:        []int{1, 2, 3},
+			r:        []int{3, 4, 1, 2},
+			expected: []string{"value[1] added"},
+		},
+		"removed": {
+			l:        []int{1, 2, 3},
+			r:        []int{3, 1},
+			expected: []string{"value[1] removed"},
+		},
+		"replaced": {
+			l:        []string{"a", "b", "c"},
+			r:        []string{"c", "d", "a"},
+			expected: []string{"value[1] removed", "value[1] added"},
+		},
+		"duplicates": {
+			l:        []int{1, 1, 2},
+			r:        []int{2, 1},
+			expected: []string{"value[1] removed"},
+		},
+		"not lists": {
+			l:        testStruct{S: "a"},
+			r:        testStruct{S: "b"},
+			expected: []string{"value.S is not equal"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			diffs := deephash.DiffIgnoringOrder(tc.l, tc.r)
+			if !reflect.DeepEqual(diffs, tc.expected) {
+				t.Errorf("got %#v, want %#v", diffs, tc.expected)
+			}
+		})
+	}
+}